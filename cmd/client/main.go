@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"flag"
 	"fmt"
 	"time"
 
@@ -13,6 +15,16 @@ import (
 )
 
 func main() {
+	var tlsOpts client.TLSOptions
+	useTLS := flag.Bool("tls", false, "connect with tls")
+	flag.StringVar(&tlsOpts.CAFile, "tls-ca", "", "server root certificate (default system roots)")
+	flag.StringVar(&tlsOpts.CertFile, "tls-cert", "", "client certificate for mutual tls")
+	flag.StringVar(&tlsOpts.KeyFile, "tls-key", "", "client certificate key")
+	flag.StringVar(&tlsOpts.ServerName, "tls-server-name", "", "server name in certificate (default server host)")
+	socket := flag.String("unix-socket", "", "connect to unix socket instead of tcp")
+	timeout := flag.Duration("timeout", time.Second, "response timeout, blocking commands wait longer by their own timeout")
+	flag.Parse()
+
 	cfg, err := cmd.ReadConfig()
 	if err != nil {
 		fmt.Println(err)
@@ -24,7 +36,23 @@ func main() {
 		Output: "./client-output.log",
 	})
 
-	c, cl, err := client.NewClientTCP(cfg.Network.Address.String(), logger, time.Second)
+	var tlsConfig *tls.Config
+	if *useTLS || tlsOpts.CAFile != "" || tlsOpts.CertFile != "" {
+		if tlsConfig, err = client.NewTLSConfig(tlsOpts); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	address := cfg.Network.Address.String()
+	if *socket == "" && cfg.Network.DisableTCP {
+		*socket = cfg.Network.UnixSocket.Path
+	}
+	if *socket != "" {
+		address = internal.UnixScheme + *socket
+	}
+
+	c, cl, err := client.NewClientTCP(address, logger, *timeout, cfg.Network.MaxMessageSize, tlsConfig)
 	if err != nil {
 		fmt.Println(err)
 		return
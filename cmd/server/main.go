@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
@@ -36,7 +38,23 @@ var helpCmd = &cobra.Command{
 	Use:   "help",
 	Short: "show command info",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Use: GET [KEY] [VALUE], SET [key] [value], DEL [key]")
+		fmt.Println(commandsUsage)
+	},
+}
+
+var hashPasswordCmd = &cobra.Command{
+	Use:   "hash-password [password]",
+	Short: "print password hash for auth.users config",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hash, err := internal.HashPassword(args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(hash)
+
+		return nil
 	},
 }
 
@@ -48,6 +66,28 @@ var runCmd = &cobra.Command{
 	},
 }
 
+const commandsUsage = `Use:
+  GET [key], SET [key] [value] [NX|XX], DEL [key]
+  MGET [key...], MSET [key value...], MDEL [key...]
+  INCR [key], DECR [key], INCRBY [key] [delta], INCRBYFLOAT [key] [delta]
+  TYPE [key]
+  HSET [key] [field value...], HGET [key] [field], HDEL [key] [field...], HGETALL [key], HKEYS [key]
+  LPUSH [key] [value...], RPUSH [key] [value...], LPOP [key], RPOP [key],
+  LRANGE [key] [start] [stop], LLEN [key], BLPOP [key] [timeout seconds]
+  SADD [key] [member...], SREM [key] [member...], SMEMBERS [key], SISMEMBER [key] [member],
+  SINTER [key...], SUNION [key...]
+  ZADD [key] [score member...], ZRANGE [key] [start] [stop], ZRANGEBYSCORE [key] [min] [max],
+  ZRANK [key] [member], ZREM [key] [member...]
+  KEYS [pattern], SCAN [cursor] [MATCH pattern] [COUNT count]
+  SELECT [namespace], FLUSHDB, INFO
+  EXISTS [key...], RENAME [src] [dst], COPY [src] [dst] [REPLACE], DBSIZE, FLUSHALL
+  APPEND [key] [value], STRLEN [key], GETRANGE [key] [start] [end], SETRANGE [key] [offset] [value],
+  GETSET [key] [value], GETDEL [key], SETNX [key] [value]
+  PING, AUTH [user] [password], ACL WHOAMI|LIST
+  PUBLISH [channel] [message], SUBSCRIBE [channel...], PSUBSCRIBE [pattern...],
+  UNSUBSCRIBE [channel...], PUNSUBSCRIBE [pattern...]
+  SLOWLOG GET [count], SLOWLOG LEN, SLOWLOG RESET`
+
 const (
 	defaultConfigFilename  = "$HOME/key-value-storage.yaml"
 	defaultAppMode         = internal.ConsoleAppMode
@@ -57,12 +97,20 @@ const (
 	defaultMaxConnections  = 10
 	defaultMaxMessageSize  = 4096
 	defaultIdleTimeout     = 5 * time.Minute
+	defaultDrainTimeout    = 10 * time.Second
 	defaultLogLevel        = "info"
 	defaultLogOutput       = "console"
 	defaultWalBatchSize    = 100
 	defaultWalBatchTimeout = 100 * time.Millisecond
 	defaultWalSegmentSize  = 10 * 1024 * 1024 // 10MB
 	defaultWalDataDir      = "$HOME/wal"
+	defaultAuthMaxFailures = 5
+	defaultAuthLockout     = time.Second
+	defaultPubSubBuffer    = 1024
+	defaultAcceptQueue     = 64
+	defaultAcceptTimeout   = 5 * time.Second
+	defaultAdminMaxConns   = 4
+	defaultSlowLogMaxLen   = 128
 )
 
 var cfgFilePath string
@@ -88,6 +136,19 @@ func init() {
 	runCmd.PersistentFlags().Duration("idle-timeout", 0,
 		"close tcp connection if has no activity in (default"+defaultIdleTimeout.String()+")",
 	)
+	runCmd.PersistentFlags().Duration("drain-timeout", 0,
+		"wait for running queries on shutdown (default "+defaultDrainTimeout.String()+")",
+	)
+	runCmd.PersistentFlags().String("tls-cert", "", "tls certificate, enables tls")
+	runCmd.PersistentFlags().String("tls-key", "", "tls certificate key")
+	runCmd.PersistentFlags().String("tls-client-ca", "", "client root certificate, requires client certificates")
+	runCmd.PersistentFlags().String("tls-min-version", "", "minimal tls version 1.2 or 1.3 (default 1.2)")
+	runCmd.PersistentFlags().String("unix-socket", "", "also serve on unix socket at path")
+	runCmd.PersistentFlags().Uint32("unix-socket-permissions", 0, "unix socket file permissions, e.g. 0660 (default umask)")
+	runCmd.PersistentFlags().Bool("disable-tcp", false, "serve only on unix socket")
+	runCmd.PersistentFlags().String("http-address", "", "also serve http/json gateway on address, e.g. 127.0.0.1:8080")
+	runCmd.PersistentFlags().String("admin-address", "", "also listen for operators on address with separate connection limit")
+	runCmd.PersistentFlags().Duration("slowlog-threshold", 0, "record queries slower than threshold in SLOWLOG (default disabled)")
 	runCmd.PersistentFlags().StringP("engine", "", "",
 		"engine type (default "+string(defaultEngineType)+")",
 	)
@@ -116,6 +177,25 @@ func init() {
 	if err := viper.BindPFlag("network.idle_timeout", runCmd.PersistentFlags().Lookup("idle-timeout")); err != nil {
 		panic(err)
 	}
+	if err := viper.BindPFlag("network.drain_timeout", runCmd.PersistentFlags().Lookup("drain-timeout")); err != nil {
+		panic(err)
+	}
+	for key, flag := range map[string]string{
+		"network.tls.cert":                "tls-cert",
+		"network.tls.key":                 "tls-key",
+		"network.tls.client_ca":           "tls-client-ca",
+		"network.tls.min_version":         "tls-min-version",
+		"network.unix_socket.path":        "unix-socket",
+		"network.unix_socket.permissions": "unix-socket-permissions",
+		"network.disable_tcp":             "disable-tcp",
+		"network.http.address":            "http-address",
+		"network.admin.address":           "admin-address",
+		"slowlog.threshold":               "slowlog-threshold",
+	} {
+		if err := viper.BindPFlag(key, runCmd.PersistentFlags().Lookup(flag)); err != nil {
+			panic(err)
+		}
+	}
 	if err := viper.BindPFlag("engine.type", runCmd.PersistentFlags().Lookup("engine")); err != nil {
 		panic(err)
 	}
@@ -135,6 +215,10 @@ func init() {
 	viper.SetDefault("network.max_connections", defaultMaxConnections)
 	viper.SetDefault("network.max_message_size", defaultMaxMessageSize)
 	viper.SetDefault("network.idle_timeout", defaultIdleTimeout.String())
+	viper.SetDefault("network.drain_timeout", defaultDrainTimeout.String())
+	viper.SetDefault("network.accept_queue", defaultAcceptQueue)
+	viper.SetDefault("network.accept_timeout", defaultAcceptTimeout.String())
+	viper.SetDefault("network.admin.max_connections", defaultAdminMaxConns)
 	viper.SetDefault("engine.type", defaultEngineType)
 	viper.SetDefault("logging.level", defaultLogLevel)
 	viper.SetDefault("logging.output", defaultLogOutput)
@@ -143,9 +227,15 @@ func init() {
 	viper.SetDefault("wal.flushing_batch_timeout", defaultWalBatchTimeout)
 	viper.SetDefault("wal.max_segment_size", defaultWalSegmentSize)
 	viper.SetDefault("wal.data_directory", defaultWalDataDir)
+	viper.SetDefault("auth.max_failures", defaultAuthMaxFailures)
+	viper.SetDefault("auth.lockout", defaultAuthLockout.String())
+	viper.SetDefault("pubsub.buffer_size", defaultPubSubBuffer)
+	viper.SetDefault("pubsub.slow_consumer", internal.SlowConsumerDrop)
+	viper.SetDefault("slowlog.max_len", defaultSlowLogMaxLen)
 
 	rootCmd.AddCommand(helpCmd)
 	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(hashPasswordCmd)
 }
 
 var cfg internal.Config
@@ -187,48 +277,141 @@ func StartServer(cfg internal.Config) {
 		return
 	}
 
-	db, err := newDB(cfg.Engine, logger)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// wal пишет команды, пока соединения завершают запросы, поэтому останавливается последним
+	walCtx, stopWal := context.WithCancel(context.Background())
+	defer stopWal()
+
+	// счетчики общие для TCP-сервера и HTTP шлюза и выводятся в INFO
+	stats := internal.NewServerCounters()
+
+	db, closeDB, err := newDB(walCtx, cfg, stats, logger)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	runner, err := newRunner(cfg, db, logger)
+	// ограничения пользователей общие для TCP-сервера и HTTP шлюза
+	userLimits := internal.NewUserRateLimits(cfg.Network.RateLimit)
+
+	serverOpts := []internal.ServerOption{internal.WithUserRateLimits(userLimits), internal.WithServerCounters(stats)}
+	runner, err := newRunner(cfg, db, serverOpts, logger)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	ctx := context.Background()
+	// шлюз работает вместе с основным режимом, его ошибка останавливает сервер
+	httpDone := make(chan error, 1)
+	if cfg.Network.HTTP.Enabled() {
+		go func() {
+			err := internal.NewServerHTTP(cfg.Network, db, logger, serverOpts...).Run(ctx)
+			stop()
+			httpDone <- err
+		}()
+	} else {
+		httpDone <- nil
+	}
+
+	started := time.Now()
 	err = runner.Run(ctx)
 	if err != nil {
 		fmt.Println(err)
 	}
+	stop()
+	if err = <-httpDone; err != nil {
+		fmt.Println("http gateway:", err)
+	}
+
+	stopWal()
+	if err = closeDB(); err != nil {
+		fmt.Println("failed to close wal:", err)
+	}
+
+	summary := fmt.Sprintf("stopped after %s", time.Since(started).Round(time.Second))
+	if _, ok := runner.(*internal.ServerTCP); ok {
+		total := stats.Stats()
+		summary += fmt.Sprintf(": %d connections, %d queued, %d rejected, %d queries, %d rate limited, %d delayed",
+			total.Connections, total.Queued, total.Rejected, total.Queries, total.RateLimited, total.Delayed)
+	}
+	fmt.Println(summary)
+	logger.Info().Msg(summary)
 }
 
-func newDB(cfg internal.EngineConfig, logger zerolog.Logger) (*internal.DB, error) {
-	if cfg.Type == internal.InMemoryEngineType {
-		return internal.NewDB(
-			internal.NewParser(logger),
-			internal.NewStorage(internal.NewInMemoryEngine(), logger),
-			logger,
-		), nil
+// newDB создает базу и восстанавливает ее из wal. closeDB записывает
+// и синхронизирует с диском оставшиеся команды wal
+func newDB(ctx context.Context, cfg internal.Config, stats *internal.ServerCounters, logger zerolog.Logger) (db *internal.DB, closeDB func() error, err error) {
+	auth, err := internal.NewAuthenticator(cfg.Auth)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to configure users")
+	}
+
+	broker, err := internal.NewBroker(cfg.PubSub, logger)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to configure pub/sub")
+	}
+
+	events, err := internal.NewKeyspaceEvents(cfg.Notifications, broker)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to configure keyspace notifications")
+	}
+
+	slowLog := internal.NewSlowQueryLog(cfg.SlowLog, logger)
+
+	if !cfg.Wal.Enabled {
+		storage, err := internal.NewStorageWithEngine(cfg.Engine, nil, events, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		closeDB = func() error { return nil }
+
+		return internal.NewDB(internal.NewParser(logger), storage, logger,
+			internal.WithAuth(auth), internal.WithBroker(broker), internal.WithSlowLog(slowLog), internal.WithServerStats(stats)), closeDB, nil
+	}
+
+	wal, err := internal.NewWal(cfg.Wal, logger)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create wal")
+	}
+
+	storage, err := internal.NewStorageWithEngine(cfg.Engine, wal, events, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = internal.ReadSegments(cfg.Wal.DataDir, storage.Restore); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to restore from wal")
+	}
+
+	walDone := make(chan struct{})
+	go func() {
+		defer close(walDone)
+		wal.Run(ctx)
+	}()
+
+	closeDB = func() error {
+		<-walDone
+		return wal.Close()
 	}
 
-	return nil, errors.New("unknown engine type")
+	return internal.NewDB(internal.NewParser(logger), storage, logger,
+		internal.WithAuth(auth), internal.WithBroker(broker), internal.WithSlowLog(slowLog), internal.WithServerStats(stats)), closeDB, nil
 }
 
 type iRunner interface {
 	Run(ctx context.Context) error
 }
 
-func newRunner(cfg internal.Config, db *internal.DB, logger zerolog.Logger) (iRunner, error) {
+func newRunner(cfg internal.Config, db *internal.DB, serverOpts []internal.ServerOption, logger zerolog.Logger) (iRunner, error) {
 	if cfg.Mode == internal.ConsoleAppMode {
 		return internal.NewConsole(db, logger), nil
 	}
 
 	if cfg.Mode == internal.TCPAppMode {
-		return internal.NewServerTCP(cfg.Network, db, logger), nil
+		return internal.NewServerTCP(cfg.Network, db, logger, serverOpts...), nil
 	}
 
 	return nil, errors.New("invalid app mode")
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Подкоманды ACL
+const (
+	ACLWhoAmI = "WHOAMI"
+	ACLList   = "LIST"
+)
+
+var ErrNoPermission = errors.New("no permission")
+
+// ACLRule права пользователя: разрешенные команды, шаблоны ключей и запрет записи.
+// Пустые списки команд и ключей ничего не ограничивают
+type ACLRule struct {
+	User     string
+	Commands []CommandType
+	Keys     []string
+	ReadOnly bool
+}
+
+func newACLRule(user UserConfig) ACLRule {
+	rule := ACLRule{
+		User:     user.Name,
+		Keys:     user.Keys,
+		ReadOnly: user.ReadOnly,
+	}
+	for _, command := range user.Commands {
+		rule.Commands = append(rule.Commands, CommandType(strings.ToUpper(command)))
+	}
+
+	return rule
+}
+
+// Check проверяет, может ли пользователь выполнить команду, и возвращает запрещенный ключ
+func (r ACLRule) Check(command Command) (string, error) {
+	// AUTH нужен, чтобы сменить пользователя, поэтому доступен всегда
+	if command.Type == Auth {
+		return "", nil
+	}
+
+	if len(r.Commands) != 0 && !slices.Contains(r.Commands, command.Type) {
+		return "", errors.Wrapf(ErrNoPermission, "user %s can't run %s", r.User, command.Type)
+	}
+
+	if r.ReadOnly && command.isWrite() {
+		return "", errors.Wrapf(ErrNoPermission, "user %s is read-only", r.User)
+	}
+
+	if len(r.Keys) == 0 {
+		return "", nil
+	}
+
+	keys, ok := command.keyArgs()
+	if !ok {
+		return "", errors.Wrapf(ErrNoPermission, "user %s can't run %s on the whole keyspace", r.User, command.Type)
+	}
+
+	for _, key := range keys {
+		if !slices.ContainsFunc(r.Keys, func(pattern string) bool {
+			return MatchPattern(pattern, key)
+		}) {
+			return key, errors.Wrapf(ErrNoPermission, "user %s can't access key %s", r.User, key)
+		}
+	}
+
+	return "", nil
+}
+
+// String описывает правило в одну строку: user <имя> ~<ключи> +<команды> [readonly]
+func (r ACLRule) String() string {
+	parts := []string{"user", r.User}
+	for _, pattern := range r.Keys {
+		parts = append(parts, "~"+pattern)
+	}
+	if len(r.Keys) == 0 {
+		parts = append(parts, "~*")
+	}
+	for _, command := range r.Commands {
+		parts = append(parts, "+"+string(command))
+	}
+	if len(r.Commands) == 0 {
+		parts = append(parts, "+@all")
+	}
+	if r.ReadOnly {
+		parts = append(parts, "readonly")
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// checkACL проверяет права пользователя сессии. Правила есть только у пользователей из конфигурации,
+// остальным (например, клиентам с сертификатом без записи в конфигурации) доступен только AUTH.
+// Без пользователей в конфигурации и в локальной консоли права не проверяются
+func (db *DB) checkACL(ctx context.Context, command Command) error {
+	session := SessionFromContext(ctx)
+	if db.auth == nil || !db.auth.Enabled() || session == nil || session.Trusted() {
+		return nil
+	}
+
+	user := session.User()
+	var key string
+	var err error
+	if rule, has := db.auth.Rule(user); has {
+		key, err = rule.Check(command)
+	} else if command.Type != Auth {
+		err = errors.Wrapf(ErrNoPermission, "user %s has no permissions", user)
+	}
+
+	if err != nil {
+		db.logger.Warn().
+			Str("user", user).
+			Str("command", string(command.Type)).
+			Str("key", key).
+			Str("client", session.Addr).
+			Msg("acl denied")
+	}
+
+	return err
+}
+
+// acl выполняет ACL WHOAMI и ACL LIST
+func (db *DB) acl(ctx context.Context, subcommand string) Reply {
+	if strings.EqualFold(subcommand, ACLWhoAmI) {
+		user := DefaultUser
+		if session := SessionFromContext(ctx); session != nil && session.User() != "" {
+			user = session.User()
+		}
+
+		return stringReply(user)
+	}
+
+	var rules []string
+	if db.auth != nil {
+		for _, rule := range db.auth.Rules() {
+			rules = append(rules, rule.String())
+		}
+	}
+
+	return listReply(rules)
+}
@@ -0,0 +1,145 @@
+package internal_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+)
+
+func TestDB_ACL(t *testing.T) {
+	hash, err := internal.HashPassword("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := internal.NewAuthenticator(internal.AuthConfig{
+		Users: []internal.UserConfig{
+			{Name: internal.DefaultUser, Password: hash},
+			{Name: "reader", Password: hash, Commands: []string{"get", "mget", "set", "acl", "slowlog"}, Keys: []string{"r*"}, ReadOnly: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.Nop()
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := internal.NewDB(internal.NewParser(logger), storage, logger, internal.WithAuth(auth))
+
+	ctx := internal.ContextWithSession(context.Background(), internal.NewSession())
+	if _, err = db.Query(ctx, "AUTH reader s3cret"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		err   error
+	}{
+		{query: "GET r1", err: internal.ErrNotFound},
+		{query: "MGET r1 r2"},
+		{query: "ACL WHOAMI"},
+		{query: "GET x1", err: internal.ErrNoPermission},
+		{query: "MGET r1 x1", err: internal.ErrNoPermission},
+		{query: "SET r1 1", err: internal.ErrNoPermission},
+		{query: "DEL r1", err: internal.ErrNoPermission},
+		{query: "SLOWLOG RESET", err: internal.ErrNoPermission},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if _, err := db.Query(ctx, tt.query); !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+
+	if whoami, _ := db.Query(ctx, "ACL WHOAMI"); whoami != "reader" {
+		t.Errorf("unexpected WHOAMI %q", whoami)
+	}
+
+	t.Run("identity without rule", func(t *testing.T) {
+		// например, сертификат клиента с именем, которого нет в конфигурации
+		session := internal.NewSession()
+		session.SetUser("stranger")
+		ctx := internal.ContextWithSession(context.Background(), session)
+		if _, err := db.Query(ctx, "GET r1"); !errors.Is(err, internal.ErrNoPermission) {
+			t.Errorf("expected ErrNoPermission, got %v", err)
+		}
+		if _, err := db.Query(ctx, "AUTH reader s3cret"); err != nil {
+			t.Errorf("expected AUTH to be allowed, got %v", err)
+		}
+	})
+
+	if _, err = db.Query(ctx, "AUTH s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	list, err := db.Query(ctx, "ACL LIST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"user default ~* +@all" "user reader ~r* +GET +MGET +SET +ACL +SLOWLOG readonly"`; list != want {
+		t.Errorf("unexpected ACL LIST %q, want %q", list, want)
+	}
+}
+
+func TestDB_ACLChannels(t *testing.T) {
+	hash, err := internal.HashPassword("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := internal.NewAuthenticator(internal.AuthConfig{
+		Users: []internal.UserConfig{{Name: "watcher", Password: hash, Keys: []string{"r*"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.Nop()
+	broker, err := internal.NewBroker(internal.PubSubConfig{BufferSize: 16, SlowConsumer: internal.SlowConsumerDrop}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := internal.NewDB(internal.NewParser(logger), storage, logger, internal.WithAuth(auth), internal.WithBroker(broker))
+
+	tests := []struct {
+		args []string
+		err  error
+	}{
+		{args: []string{"SUBSCRIBE", "news", internal.KeyspaceChannel + "r1"}},
+		{args: []string{"SUBSCRIBE", internal.KeyspaceChannel + "x1"}, err: internal.ErrNoPermission},
+		{args: []string{"SUBSCRIBE", internal.KeyeventChannel + "set"}, err: internal.ErrNoPermission},
+		{args: []string{"PSUBSCRIBE", "news.*"}},
+		{args: []string{"PSUBSCRIBE", internal.KeyspaceChannel + "r1"}},
+		{args: []string{"PSUBSCRIBE", internal.KeyspaceChannel + "r*"}, err: internal.ErrNoPermission},
+		{args: []string{"PSUBSCRIBE", "*"}, err: internal.ErrNoPermission},
+		{args: []string{"PSUBSCRIBE", "__key*"}, err: internal.ErrNoPermission},
+		{args: []string{"PUBLISH", "news", "hello"}},
+		{args: []string{"PUBLISH", internal.KeyspaceChannel + "r1", "set"}},
+		{args: []string{"PUBLISH", internal.KeyspaceChannel + "x1", "del"}, err: internal.ErrNoPermission},
+		{args: []string{"PUBLISH", internal.KeyeventChannel + "del", "x1"}, err: internal.ErrNoPermission},
+		{args: []string{"SLOWLOG", "GET"}, err: internal.ErrNoPermission},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			session := internal.NewSession()
+			session.AllowPush()
+			ctx := internal.ContextWithSession(context.Background(), session)
+			if _, err := db.QueryArgs(ctx, []string{"AUTH", "watcher", "s3cret"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.QueryArgs(ctx, tt.args); !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
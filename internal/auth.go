@@ -0,0 +1,282 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultUser пользователь команды AUTH с одним паролем и консоли
+const DefaultUser = "default"
+
+const (
+	passwordHashScheme = "sha256"
+	passwordHashRounds = 10000
+	passwordSaltSize   = 16
+
+	defaultMaxAuthFailures = 5
+	defaultAuthLockout     = time.Second
+	maxAuthLockout         = 5 * time.Minute
+)
+
+// dummyPasswordHash проверяется для неизвестного пользователя, чтобы время ответа
+// не выдавало, какие пользователи существуют
+var dummyPasswordHash = formatPasswordHash(passwordHashRounds, make([]byte, passwordSaltSize), make([]byte, sha256.Size))
+
+var (
+	ErrAuthRequired = errors.New("authentication required")
+	ErrAuthFailed   = errors.New("invalid user or password")
+	ErrAuthLocked   = errors.New("too many failed attempts, try later")
+)
+
+// UserConfig пользователь сервера, Password хранит результат HashPassword.
+// Commands, Keys и ReadOnly задают права пользователя, пустые списки ничего не ограничивают
+type UserConfig struct {
+	Name     string   `yaml:"name" mapstructure:"name"`
+	Password string   `yaml:"password" mapstructure:"password"`
+	Commands []string `yaml:"commands" mapstructure:"commands"`
+	Keys     []string `yaml:"keys" mapstructure:"keys"`
+	ReadOnly bool     `yaml:"read_only" mapstructure:"read_only"`
+}
+
+// AuthConfig настройки аутентификации, без пользователей AUTH не требуется
+type AuthConfig struct {
+	Users []UserConfig `yaml:"users" mapstructure:"users"`
+	// MaxFailures число неудачных попыток подряд, после которого вход блокируется
+	MaxFailures int `yaml:"max_failures" mapstructure:"max_failures"`
+	// Lockout время первой блокировки, каждая следующая неудача удваивает его
+	Lockout time.Duration `yaml:"lockout" mapstructure:"lockout"`
+}
+
+// HashPassword возвращает соленый хеш пароля в формате sha256$rounds$salt$hash
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", errors.Wrap(err, "failed to generate salt")
+	}
+
+	return formatPasswordHash(passwordHashRounds, salt, hashPassword(password, salt, passwordHashRounds)), nil
+}
+
+func formatPasswordHash(rounds int, salt, hash []byte) string {
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("%s$%d$%s$%s", passwordHashScheme, rounds, enc.EncodeToString(salt), enc.EncodeToString(hash))
+}
+
+func hashPassword(password string, salt []byte, rounds int) []byte {
+	sum := sha256.Sum256(append(salt, password...))
+	for range rounds - 1 {
+		sum = sha256.Sum256(sum[:])
+	}
+
+	return sum[:]
+}
+
+// verifyPassword сравнивает пароль с хешем за время, не зависящее от совпадения
+func verifyPassword(passwordHash, password string) (bool, error) {
+	parts := strings.Split(passwordHash, "$")
+	if len(parts) != 4 || parts[0] != passwordHashScheme {
+		return false, errors.New("unsupported password hash format")
+	}
+
+	rounds, err := strconv.Atoi(parts[1])
+	if err != nil || rounds < 1 {
+		return false, errors.Errorf("invalid password hash rounds %s", parts[1])
+	}
+
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return false, errors.Wrap(err, "invalid password hash salt")
+	}
+	expected, err := enc.DecodeString(parts[3])
+	if err != nil {
+		return false, errors.Wrap(err, "invalid password hash")
+	}
+
+	return subtle.ConstantTimeCompare(hashPassword(password, salt, rounds), expected) == 1, nil
+}
+
+type authFailures struct {
+	count       int
+	lockedUntil time.Time
+	last        time.Time
+}
+
+// Authenticator проверяет пароли пользователей и блокирует подбор:
+// после MaxFailures неудач подряд с одного адреса для пользователя вход закрывается
+// на Lockout, каждая следующая неудача удваивает время блокировки
+type Authenticator struct {
+	users       map[string]string
+	rules       map[string]ACLRule
+	maxFailures int
+	lockout     time.Duration
+
+	failuresMtx sync.Mutex
+	failures    map[string]*authFailures
+}
+
+func NewAuthenticator(cfg AuthConfig) (*Authenticator, error) {
+	users := make(map[string]string, len(cfg.Users))
+	rules := make(map[string]ACLRule, len(cfg.Users))
+	for _, user := range cfg.Users {
+		if user.Name == "" {
+			return nil, errors.New("user name is empty")
+		}
+		if _, err := verifyPassword(user.Password, ""); err != nil {
+			return nil, errors.Wrapf(err, "user %s", user.Name)
+		}
+		users[user.Name] = user.Password
+		rules[user.Name] = newACLRule(user)
+	}
+
+	a := &Authenticator{
+		users:       users,
+		rules:       rules,
+		maxFailures: cfg.MaxFailures,
+		lockout:     cfg.Lockout,
+		failures:    make(map[string]*authFailures),
+	}
+	if a.maxFailures <= 0 {
+		a.maxFailures = defaultMaxAuthFailures
+	}
+	if a.lockout <= 0 {
+		a.lockout = defaultAuthLockout
+	}
+
+	return a, nil
+}
+
+// Enabled сообщает, что соединения должны пройти AUTH
+func (a *Authenticator) Enabled() bool {
+	return len(a.users) != 0
+}
+
+// Rule возвращает права пользователя из конфигурации
+func (a *Authenticator) Rule(user string) (ACLRule, bool) {
+	rule, has := a.rules[user]
+
+	return rule, has
+}
+
+// Rules возвращает права всех пользователей, упорядоченные по имени
+func (a *Authenticator) Rules() []ACLRule {
+	rules := make([]ACLRule, 0, len(a.rules))
+	for _, rule := range a.rules {
+		rules = append(rules, rule)
+	}
+	slices.SortFunc(rules, func(a, b ACLRule) int {
+		return strings.Compare(a.User, b.User)
+	})
+
+	return rules
+}
+
+// Authenticate проверяет пароль пользователя, addr адрес клиента для учета неудачных попыток
+func (a *Authenticator) Authenticate(addr, user, password string) error {
+	// порт у каждого соединения свой, попытки считаются по хосту.
+	// Адрес клиента Unix-сокета не зависит от соединения и используется целиком
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || strings.HasPrefix(addr, UnixScheme) {
+		host = addr
+	}
+	key := host + "/" + user
+	now := time.Now()
+
+	// попытка заранее считается неудачной, поэтому параллельные AUTH
+	// не могут обойти блокировку, пока пароли проверяются
+	a.failuresMtx.Lock()
+	if f, has := a.failures[key]; has && now.Before(f.lockedUntil) {
+		a.failuresMtx.Unlock()
+		return errors.Wrapf(ErrAuthLocked, "locked for %s", f.lockedUntil.Sub(now).Round(time.Second))
+	}
+	a.recordFailure(key, now)
+	a.failuresMtx.Unlock()
+
+	passwordHash, has := a.users[user]
+	if !has {
+		passwordHash = dummyPasswordHash
+	}
+	ok, err := verifyPassword(passwordHash, password)
+	if err != nil {
+		return err
+	}
+	if !ok || !has {
+		return ErrAuthFailed
+	}
+
+	a.failuresMtx.Lock()
+	delete(a.failures, key)
+	a.failuresMtx.Unlock()
+
+	return nil
+}
+
+func (a *Authenticator) recordFailure(key string, now time.Time) {
+	// старые записи удаляются, чтобы перебор адресов не раздувал карту
+	for k, f := range a.failures {
+		if now.Sub(f.last) > maxAuthLockout && now.After(f.lockedUntil) {
+			delete(a.failures, k)
+		}
+	}
+
+	f, has := a.failures[key]
+	if !has {
+		f = &authFailures{}
+		a.failures[key] = f
+	}
+
+	f.count++
+	f.last = now
+	if f.count >= a.maxFailures {
+		lockout := a.lockout << min(f.count-a.maxFailures, 16)
+		f.lockedUntil = now.Add(min(lockout, maxAuthLockout))
+	}
+}
+
+// authenticate выполняет AUTH [user] password для сессии из контекста
+func authenticate(ctx context.Context, auth *Authenticator, args []string) error {
+	session := SessionFromContext(ctx)
+	if session == nil {
+		return errors.Wrap(ErrInvalidCommand, "auth requires a connection session")
+	}
+	if auth == nil || !auth.Enabled() {
+		return errors.Wrap(ErrInvalidCommand, "no users configured")
+	}
+
+	user, password := DefaultUser, args[0]
+	if len(args) == 2 {
+		user, password = args[0], args[1]
+	}
+
+	if err := auth.Authenticate(session.Addr, user, password); err != nil {
+		return err
+	}
+	session.SetUser(user)
+
+	return nil
+}
+
+// redactArgs скрывает пароль команды AUTH перед записью в лог
+func redactArgs(args []string) []string {
+	if len(args) > 1 && strings.EqualFold(args[0], string(Auth)) {
+		return []string{args[0], "***"}
+	}
+
+	return args
+}
+
+func redactQuery(query string) string {
+	return strings.Join(redactArgs(strings.Split(query, " ")), " ")
+}
@@ -0,0 +1,117 @@
+package internal_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+)
+
+func TestAuthenticator(t *testing.T) {
+	hash, err := internal.HashPassword("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := internal.NewAuthenticator(internal.AuthConfig{
+		Users:       []internal.UserConfig{{Name: "reporter", Password: hash}},
+		MaxFailures: 2,
+		Lockout:     time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const addr = "10.0.0.1:5000"
+	if err = auth.Authenticate(addr, "reporter", "s3cret"); err != nil {
+		t.Fatalf("expected valid password, got %v", err)
+	}
+
+	for range 2 {
+		if err = auth.Authenticate(addr, "reporter", "guess"); !errors.Is(err, internal.ErrAuthFailed) {
+			t.Fatalf("expected ErrAuthFailed, got %v", err)
+		}
+	}
+
+	// с другого порта того же хоста вход тоже заблокирован, даже с верным паролем
+	if err = auth.Authenticate("10.0.0.1:5001", "reporter", "s3cret"); !errors.Is(err, internal.ErrAuthLocked) {
+		t.Fatalf("expected ErrAuthLocked, got %v", err)
+	}
+	if err = auth.Authenticate("10.0.0.2:5000", "reporter", "s3cret"); err != nil {
+		t.Fatalf("expected other host to log in, got %v", err)
+	}
+	if err = auth.Authenticate("10.0.0.2:5000", "unknown", ""); !errors.Is(err, internal.ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed for unknown user, got %v", err)
+	}
+
+	// клиенты Unix-сокета различаются по uid, а не по хосту "unix"
+	for range 2 {
+		_ = auth.Authenticate(internal.UnixScheme+"/run/kv.sock#uid=1000", "reporter", "guess")
+	}
+	if err = auth.Authenticate(internal.UnixScheme+"/run/kv.sock#uid=1000", "reporter", "s3cret"); !errors.Is(err, internal.ErrAuthLocked) {
+		t.Fatalf("expected ErrAuthLocked for unix peer, got %v", err)
+	}
+	if err = auth.Authenticate(internal.UnixScheme+"/run/kv.sock#uid=1001", "reporter", "s3cret"); err != nil {
+		t.Fatalf("expected other unix peer to log in, got %v", err)
+	}
+
+	t.Run("parallel attempts", func(t *testing.T) {
+		// одновременные попытки не проходят проверку блокировки все сразу
+		var failed atomic.Int32
+		var wg sync.WaitGroup
+		for range 100 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := auth.Authenticate("10.0.0.3:5000", "reporter", "guess"); errors.Is(err, internal.ErrAuthFailed) {
+					failed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if failed.Load() != 2 {
+			t.Errorf("expected 2 checked attempts, got %d", failed.Load())
+		}
+	})
+}
+
+func TestDB_Auth(t *testing.T) {
+	hash, err := internal.HashPassword("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := internal.NewAuthenticator(internal.AuthConfig{
+		Users: []internal.UserConfig{{Name: internal.DefaultUser, Password: hash}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.Nop()
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := internal.NewDB(internal.NewParser(logger), storage, logger, internal.WithAuth(auth))
+
+	ctx := internal.ContextWithSession(context.Background(), internal.NewSession())
+	if _, err = db.Query(ctx, "SET a 1"); !errors.Is(err, internal.ErrAuthRequired) {
+		t.Fatalf("expected ErrAuthRequired, got %v", err)
+	}
+	if _, err = db.Query(ctx, "AUTH wrong"); !errors.Is(err, internal.ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed, got %v", err)
+	}
+	if _, err = db.Query(ctx, "AUTH s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Query(ctx, "SET a 1"); err != nil {
+		t.Fatalf("expected authenticated query to succeed, got %v", err)
+	}
+}
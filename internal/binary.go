@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Двоичный протокол. После рукопожатия клиент и сервер обмениваются кадрами
+//
+//	version(1) opcode(1) request_id(4) length(4) payload(length)
+//
+// числа передаются в big endian. Ответ содержит request_id запроса,
+// ответы на параллельные запросы могут приходить в любом порядке.
+//
+// Рукопожатие: клиент отправляет BinaryMagic и наибольшую поддерживаемую версию,
+// сервер отвечает BinaryMagic и выбранной версией, которая не больше версии клиента
+const (
+	BinaryVersion byte = 1
+
+	frameHeaderSize = 10
+)
+
+// BinaryMagic начало рукопожатия, первый байт не встречается в текстовых протоколах
+var BinaryMagic = []byte("\x00KVB")
+
+type Opcode byte
+
+const (
+	// OpQuery запрос, payload содержит аргументы команды
+	OpQuery Opcode = 1
+	// OpReply успешный ответ, payload содержит закодированный Reply
+	OpReply Opcode = 2
+	// OpError ошибка, payload содержит ответ EncodeResponse
+	OpError Opcode = 3
+)
+
+var ErrMessageTooLarge = errors.New("message too large")
+
+type Frame struct {
+	Version   byte
+	Opcode    Opcode
+	RequestID uint32
+	Payload   []byte
+}
+
+// WriteFrame записывает кадр одним вызовом Write
+func WriteFrame(w io.Writer, frame Frame) error {
+	buf := make([]byte, frameHeaderSize, frameHeaderSize+len(frame.Payload))
+	buf[0] = frame.Version
+	buf[1] = byte(frame.Opcode)
+	binary.BigEndian.PutUint32(buf[2:], frame.RequestID)
+	binary.BigEndian.PutUint32(buf[6:], uint32(len(frame.Payload)))
+	buf = append(buf, frame.Payload...)
+
+	_, err := w.Write(buf)
+
+	return err
+}
+
+// ReadFrame читает кадр. Размер payload проверяется до выделения памяти,
+// при превышении maxSize возвращается ErrMessageTooLarge и заголовок кадра.
+// maxSize <= 0 снимает ограничение
+func ReadFrame(r io.Reader, maxSize int) (Frame, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Frame{}, err
+	}
+
+	frame := Frame{
+		Version:   header[0],
+		Opcode:    Opcode(header[1]),
+		RequestID: binary.BigEndian.Uint32(header[2:]),
+	}
+
+	length := binary.BigEndian.Uint32(header[6:])
+	if maxSize > 0 && uint64(length) > uint64(maxSize) {
+		return frame, errors.Wrapf(ErrMessageTooLarge, "payload %d bytes exceeds %d", length, maxSize)
+	}
+
+	frame.Payload = make([]byte, length)
+	if _, err := io.ReadFull(r, frame.Payload); err != nil {
+		return Frame{}, err
+	}
+
+	return frame, nil
+}
+
+// WriteHandshake отправляет BinaryMagic и версию протокола
+func WriteHandshake(w io.Writer, version byte) error {
+	_, err := w.Write(append(bytes.Clone(BinaryMagic), version))
+
+	return err
+}
+
+// ReadHandshake читает рукопожатие и возвращает версию протокола
+func ReadHandshake(r io.Reader) (byte, error) {
+	buf := make([]byte, len(BinaryMagic)+1)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, err
+	}
+
+	if !bytes.Equal(buf[:len(BinaryMagic)], BinaryMagic) {
+		return 0, errors.Wrap(ErrProtocol, "invalid handshake")
+	}
+
+	version := buf[len(BinaryMagic)]
+	if version == 0 {
+		return 0, errors.Wrap(ErrProtocol, "invalid protocol version 0")
+	}
+
+	return version, nil
+}
+
+// EncodeArgs кодирует аргументы команды: количество и каждый аргумент с длиной
+func EncodeArgs(args []string) []byte {
+	buf := binary.BigEndian.AppendUint32(nil, uint32(len(args)))
+	for _, arg := range args {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(arg)))
+		buf = append(buf, arg...)
+	}
+
+	return buf
+}
+
+func DecodeArgs(payload []byte) ([]string, error) {
+	d := payloadDecoder{buf: payload}
+	count := d.uint32()
+	// каждый аргумент занимает не меньше 4 байт длины
+	if d.err == nil && uint64(count)*4 > uint64(len(d.buf)) {
+		return nil, errors.Wrap(ErrProtocol, "invalid args count")
+	}
+
+	args := make([]string, 0, count)
+	for range count {
+		args = append(args, d.string())
+	}
+
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+
+	return args, nil
+}
+
+// EncodeReply кодирует ответ: тип и значение, списки вместе с количеством элементов
+func EncodeReply(reply Reply) []byte {
+	return appendReply(nil, reply)
+}
+
+func appendReply(buf []byte, reply Reply) []byte {
+	buf = append(buf, byte(reply.Type))
+	switch reply.Type {
+	case StatusReply, StringReply:
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(reply.Str)))
+		buf = append(buf, reply.Str...)
+	case IntReply:
+		buf = binary.BigEndian.AppendUint64(buf, uint64(reply.Int))
+	case ArrayReply, MapReply:
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(reply.Array)))
+		for _, item := range reply.Array {
+			buf = appendReply(buf, item)
+		}
+	}
+
+	return buf
+}
+
+func DecodeReply(payload []byte) (Reply, error) {
+	d := payloadDecoder{buf: payload}
+	reply := d.reply()
+	if err := d.finish(); err != nil {
+		return Reply{}, err
+	}
+
+	return reply, nil
+}
+
+// payloadDecoder читает значения из payload, первая ошибка сохраняется в err
+type payloadDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *payloadDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.buf) < n {
+		d.err = errors.Wrap(ErrProtocol, "unexpected end of payload")
+		return nil
+	}
+
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+
+	return b
+}
+
+func (d *payloadDecoder) uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+
+	return 0
+}
+
+func (d *payloadDecoder) string() string {
+	length := d.uint32()
+	if uint64(length) > uint64(len(d.buf)) {
+		d.next(len(d.buf) + 1)
+		return ""
+	}
+
+	return string(d.next(int(length)))
+}
+
+func (d *payloadDecoder) reply() Reply {
+	b := d.next(1)
+	if b == nil {
+		return Reply{}
+	}
+
+	reply := Reply{Type: ReplyType(b[0])}
+	switch reply.Type {
+	case StatusReply, StringReply:
+		reply.Str = d.string()
+	case IntReply:
+		if b = d.next(8); b != nil {
+			reply.Int = int64(binary.BigEndian.Uint64(b))
+		}
+	case NilReply:
+	case ArrayReply, MapReply:
+		count := d.uint32()
+		// каждый элемент занимает не меньше байта типа
+		if uint64(count) > uint64(len(d.buf)) {
+			d.next(len(d.buf) + 1)
+			return Reply{}
+		}
+		reply.Array = make([]Reply, 0, count)
+		for range count {
+			reply.Array = append(reply.Array, d.reply())
+		}
+	default:
+		if d.err == nil {
+			d.err = errors.Wrapf(ErrProtocol, "unknown reply type %d", reply.Type)
+		}
+	}
+
+	return reply
+}
+
+func (d *payloadDecoder) finish() error {
+	if d.err == nil && len(d.buf) != 0 {
+		return errors.Wrapf(ErrProtocol, "%d trailing bytes in payload", len(d.buf))
+	}
+
+	return d.err
+}
@@ -0,0 +1,175 @@
+package internal_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+)
+
+func TestFrame(t *testing.T) {
+	args := []string{"SET", "k e y", "a\nb", ""}
+	frame := internal.Frame{
+		Version:   internal.BinaryVersion,
+		Opcode:    internal.OpQuery,
+		RequestID: 42,
+		Payload:   internal.EncodeArgs(args),
+	}
+
+	var buf bytes.Buffer
+	if err := internal.WriteFrame(&buf, frame); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := internal.ReadFrame(&buf, 1024)
+	if err != nil || !reflect.DeepEqual(read, frame) {
+		t.Fatalf("expected %v, got %v %v", frame, read, err)
+	}
+
+	decoded, err := internal.DecodeArgs(read.Payload)
+	if err != nil || !reflect.DeepEqual(decoded, args) {
+		t.Fatalf("expected %q, got %q %v", args, decoded, err)
+	}
+
+	t.Run("too large", func(t *testing.T) {
+		// заголовок объявляет 4GB, payload не должен читаться
+		header := []byte{internal.BinaryVersion, byte(internal.OpQuery), 0, 0, 0, 7}
+		header = binary.BigEndian.AppendUint32(header, 1<<32-1)
+
+		read, err := internal.ReadFrame(bytes.NewReader(header), 1024)
+		if !errors.Is(err, internal.ErrMessageTooLarge) || read.RequestID != 7 {
+			t.Fatalf("expected too large error for request 7, got %d %v", read.RequestID, err)
+		}
+	})
+}
+
+func TestEncodeDecodeReply(t *testing.T) {
+	reply := internal.Reply{Type: internal.ArrayReply, Array: []internal.Reply{
+		{Type: internal.StringReply, Str: "0"},
+		{Type: internal.MapReply, Array: []internal.Reply{
+			{Type: internal.StringReply, Str: "f"},
+			{Type: internal.IntReply, Int: -7},
+		}},
+		{Type: internal.NilReply},
+		{Type: internal.StatusReply, Str: "ok"},
+	}}
+
+	decoded, err := internal.DecodeReply(internal.EncodeReply(reply))
+	if err != nil || !reflect.DeepEqual(decoded, reply) {
+		t.Fatalf("expected %v, got %v %v", reply, decoded, err)
+	}
+
+	if _, err = internal.DecodeReply([]byte{byte(internal.ArrayReply), 0xff, 0xff, 0xff, 0xff}); !errors.Is(err, internal.ErrProtocol) {
+		t.Fatalf("expected protocol error, got %v", err)
+	}
+}
+
+// startServerTCP запускает сервер с базой без журнала и возвращает его адрес
+func startServerTCP(t *testing.T, cfg internal.NetworkConfig) string {
+	t.Helper()
+
+	logger := zerolog.Nop()
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := freeAddress(t)
+	cfg.Address = address
+	cfg.MaxConnections = max(cfg.MaxConnections, 10)
+	server := internal.NewServerTCP(cfg, internal.NewDB(internal.NewParser(logger), storage, logger), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = server.Run(ctx) }()
+	time.Sleep(100 * time.Millisecond)
+
+	return address.String()
+}
+
+func TestServerTCP_BinaryOrder(t *testing.T) {
+	address := startServerTCP(t, internal.NetworkConfig{IdleTimeout: time.Minute})
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	if err = internal.WriteHandshake(conn, internal.BinaryVersion); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = internal.ReadHandshake(reader); err != nil {
+		t.Fatal(err)
+	}
+
+	// pipeline отправляет запросы без ожидания ответов и возвращает ответы в порядке запросов
+	pipeline := func(queries [][]string) []string {
+		var buf bytes.Buffer
+		for i, args := range queries {
+			frame := internal.Frame{Version: internal.BinaryVersion, Opcode: internal.OpQuery, RequestID: uint32(i), Payload: internal.EncodeArgs(args)}
+			if err := internal.WriteFrame(&buf, frame); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := conn.Write(buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		replies := make([]string, len(queries))
+		for range queries {
+			frame, err := internal.ReadFrame(reader, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frame.Opcode != internal.OpReply {
+				_, err = internal.DecodeResponse(string(frame.Payload))
+				replies[frame.RequestID] = string(internal.ErrorCodeOf(err))
+				continue
+			}
+			reply, err := internal.DecodeReply(frame.Payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			replies[frame.RequestID] = reply.String()
+		}
+
+		return replies
+	}
+
+	// RPUSH не должен выполниться раньше ожидающего BLPOP
+	got := pipeline([][]string{{"BLPOP", "queue", "0.05"}, {"RPUSH", "queue", "a"}, {"LLEN", "queue"}})
+	if expected := []string{"TIMEOUT", "1", "1"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected replies %v, got %v", expected, got)
+	}
+
+	// каждый запрос зависит от предыдущего
+	var queries [][]string
+	var expected []string
+	for i := range 50 {
+		key, db := "key"+strconv.Itoa(i), strconv.Itoa(i%3+1)
+		queries = append(queries,
+			[]string{"SELECT", db},
+			[]string{"SET", key, db},
+			[]string{"GET", key},
+			[]string{"SELECT", "0"},
+			[]string{"EXISTS", key},
+		)
+		expected = append(expected, "ok", "ok", db, "ok", "0")
+	}
+	if got = pipeline(queries); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected replies %v, got %v", expected, got)
+	}
+}
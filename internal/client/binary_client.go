@@ -0,0 +1,192 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+)
+
+var ErrClosed = errors.New("connection closed")
+
+type binaryResult struct {
+	reply internal.Reply
+	err   error
+}
+
+// Binary клиент двоичного протокола. Запросы из разных горутин отправляются
+// не дожидаясь ответов на предыдущие, ответы сопоставляются по request id
+type Binary struct {
+	conn        net.Conn
+	logger      zerolog.Logger
+	readTimeout time.Duration
+	version     byte
+
+	writeMtx sync.Mutex
+	nextID   atomic.Uint32
+
+	pendingMtx sync.Mutex
+	pending    map[uint32]chan binaryResult
+	err        error
+}
+
+func NewClientBinary(address string, logger zerolog.Logger, readTimeout time.Duration, tlsConfig *tls.Config) (c *Binary, cl func(), err error) {
+	conn, err := dial(address, tlsConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	version, err := handshake(conn, reader, readTimeout)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, errors.Wrap(err, "failed to negotiate protocol")
+	}
+
+	logger.Debug().Msgf("connected to %s, protocol version %d", address, version)
+
+	c = &Binary{
+		conn:        conn,
+		logger:      logger,
+		readTimeout: readTimeout,
+		version:     version,
+		pending:     make(map[uint32]chan binaryResult),
+	}
+	go c.readResponses(reader)
+
+	cl = func() {
+		err := conn.Close()
+		if err != nil {
+			logger.Err(err).Msg("error closing connection")
+		}
+
+		logger.Info().Msg("closed connection")
+	}
+
+	return c, cl, nil
+}
+
+func handshake(conn net.Conn, reader *bufio.Reader, timeout time.Duration) (byte, error) {
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, err
+	}
+	if err := internal.WriteHandshake(conn, internal.BinaryVersion); err != nil {
+		return 0, err
+	}
+
+	version, err := internal.ReadHandshake(reader)
+	if err != nil {
+		return 0, err
+	}
+	if version > internal.BinaryVersion {
+		return 0, errors.Errorf("server chose unsupported version %d", version)
+	}
+
+	return version, conn.SetDeadline(time.Time{})
+}
+
+// Query выполняет запрос текстового протокола, аргументы разделяются пробелами
+func (c *Binary) Query(ctx context.Context, query string) (string, error) {
+	reply, err := c.Do(ctx, strings.Fields(query)...)
+	if err != nil {
+		return "", err
+	}
+
+	return reply.String(), nil
+}
+
+// Do отправляет команду и ждет ответа на нее
+func (c *Binary) Do(ctx context.Context, args ...string) (internal.Reply, error) {
+	id := c.nextID.Add(1)
+	result := make(chan binaryResult, 1)
+
+	c.pendingMtx.Lock()
+	if c.err != nil {
+		c.pendingMtx.Unlock()
+		return internal.Reply{}, c.err
+	}
+	c.pending[id] = result
+	c.pendingMtx.Unlock()
+	defer func() {
+		c.pendingMtx.Lock()
+		delete(c.pending, id)
+		c.pendingMtx.Unlock()
+	}()
+
+	c.writeMtx.Lock()
+	err := internal.WriteFrame(c.conn, internal.Frame{
+		Version:   c.version,
+		Opcode:    internal.OpQuery,
+		RequestID: id,
+		Payload:   internal.EncodeArgs(args),
+	})
+	c.writeMtx.Unlock()
+	if err != nil {
+		return internal.Reply{}, err
+	}
+
+	c.logger.Debug().Msgf("sent request %d: %q", id, args)
+
+	ctx, cl := withQueryTimeout(ctx, c.readTimeout, args)
+	defer cl()
+
+	select {
+	case <-ctx.Done():
+		return internal.Reply{}, ctx.Err()
+	case r := <-result:
+		return r.reply, r.err
+	}
+}
+
+// readResponses передает ответы ожидающим запросам, пока соединение открыто
+func (c *Binary) readResponses(reader *bufio.Reader) {
+	for {
+		frame, err := internal.ReadFrame(reader, 0)
+		if err != nil {
+			c.fail(errors.Wrapf(ErrClosed, "read failed: %v", err))
+			return
+		}
+
+		c.logger.Debug().Msgf("received response %d", frame.RequestID)
+
+		var r binaryResult
+		switch frame.Opcode {
+		case internal.OpReply:
+			r.reply, r.err = internal.DecodeReply(frame.Payload)
+		case internal.OpError:
+			// ошибки сервера возвращаются как *internal.ResponseError
+			_, r.err = internal.DecodeResponse(string(frame.Payload))
+		default:
+			r.err = errors.Wrapf(internal.ErrProtocol, "unexpected opcode %d", frame.Opcode)
+		}
+
+		c.pendingMtx.Lock()
+		result, has := c.pending[frame.RequestID]
+		delete(c.pending, frame.RequestID)
+		c.pendingMtx.Unlock()
+		if has {
+			result <- r
+		}
+	}
+}
+
+// fail завершает ожидающие запросы ошибкой соединения
+func (c *Binary) fail(err error) {
+	c.pendingMtx.Lock()
+	defer c.pendingMtx.Unlock()
+
+	c.err = err
+	for id, result := range c.pending {
+		result <- binaryResult{err: err}
+		delete(c.pending, id)
+	}
+}
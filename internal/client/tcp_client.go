@@ -3,21 +3,37 @@ package client
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"key-value-storage/internal"
 	"net"
+	"strings"
 	"sync"
 	"time"
 )
 
 type TCP struct {
-	conn        net.Conn
-	logger      zerolog.Logger
-	readTimeout time.Duration
+	conn           net.Conn
+	reader         *bufio.Reader
+	logger         zerolog.Logger
+	readTimeout    time.Duration
+	maxMessageSize int
+
+	// mtx сохраняет порядок запросов и ответов на соединении
+	mtx *sync.Mutex
 }
 
-func NewClientTCP(address string, logger zerolog.Logger, readTimeout time.Duration) (c *TCP, cl func(), err error) {
-	conn, err := net.Dial("tcp", address)
+// Result ответ на один запрос конвейера
+type Result struct {
+	Value string
+	Err   error
+}
+
+// NewClientTCP подключается к серверу, maxMessageSize ограничивает размер запроса как на сервере.
+// Если задан tlsConfig, соединение устанавливается по TLS
+func NewClientTCP(address string, logger zerolog.Logger, readTimeout time.Duration, maxMessageSize int, tlsConfig *tls.Config) (c *TCP, cl func(), err error) {
+	conn, err := dial(address, tlsConfig)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -34,58 +50,110 @@ func NewClientTCP(address string, logger zerolog.Logger, readTimeout time.Durati
 	}
 
 	return &TCP{
-		conn:        conn,
-		logger:      logger,
-		readTimeout: readTimeout,
+		conn:           conn,
+		reader:         bufio.NewReader(conn),
+		logger:         logger,
+		readTimeout:    readTimeout,
+		maxMessageSize: maxMessageSize,
+		mtx:            &sync.Mutex{},
 	}, cl, nil
 }
 
 func (c TCP) Query(ctx context.Context, query string) (string, error) {
-	var result string
+	results, err := c.Pipeline(ctx, []string{query})
+	if err != nil {
+		return "", err
+	}
+
+	return results[0].Value, results[0].Err
+}
+
+// Pipeline отправляет все запросы не дожидаясь ответов и возвращает ответы в том же порядке.
+// Ошибки сервера возвращаются в Result.Err, ошибка соединения прерывает весь конвейер
+func (c TCP) Pipeline(ctx context.Context, queries []string) ([]Result, error) {
+	// сервер закрывает соединение на слишком большой запрос, поэтому он не отправляется
+	for _, query := range queries {
+		if c.maxMessageSize > 0 && len(query) > c.maxMessageSize {
+			return nil, errors.Wrapf(internal.ErrMessageTooLarge, "query exceeds %d bytes", c.maxMessageSize)
+		}
+	}
+
+	var results []Result
 	var err error
 
 	done := make(chan struct{})
 	go func() {
 		defer close(done)
 
-		query += internal.DelimStr
-		_, err = c.conn.Write([]byte(query))
-		if err != nil {
-			return
+		// если ожидание прервано, горутина дочитывает свои ответы под блокировкой,
+		// чтобы они не достались следующему запросу
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+
+		var buf strings.Builder
+		for _, query := range queries {
+			buf.WriteString(query)
+			buf.WriteString(internal.DelimStr)
 		}
 
-		c.logger.Debug().Msgf("sent query: %s", query)
+		// запросы отправляются параллельно с чтением ответов, иначе на длинном конвейере
+		// клиент и сервер могут одновременно ждать, пока другая сторона прочитает данные
+		written := make(chan error, 1)
+		go func() {
+			_, err := c.conn.Write([]byte(buf.String()))
+			written <- err
+		}()
+		defer func() {
+			if writeErr := <-written; err == nil && writeErr != nil {
+				err = writeErr
+			}
+		}()
 
-		reader := bufio.NewReader(c.conn)
-		// Читаем ответ от сервера
-		result, err = reader.ReadString(internal.Delim)
-		if err != nil {
-			return
-		}
+		c.logger.Debug().Msgf("sending %d queries", len(queries))
 
-		c.logger.Debug().Msgf("received response: %s", result)
+		results = make([]Result, 0, len(queries))
+		for range queries {
+			// Читаем ответ от сервера
+			var line string
+			line, err = c.reader.ReadString(internal.Delim)
+			if err != nil {
+				return
+			}
+
+			c.logger.Debug().Msgf("received response: %s", line)
+
+			// ошибки сервера возвращаются как *internal.ResponseError
+			var r Result
+			r.Value, r.Err = internal.DecodeResponse(strings.TrimSuffix(line, internal.DelimStr))
+			results = append(results, r)
+		}
 	}()
-	ctx, cl := context.WithTimeout(ctx, c.readTimeout)
+
+	args := make([][]string, 0, len(queries))
+	for _, query := range queries {
+		args = append(args, strings.Fields(query))
+	}
+	ctx, cl := withQueryTimeout(ctx, c.readTimeout, args...)
 	defer cl()
 
 	select {
 	case <-ctx.Done():
-		return "", ctx.Err()
+		return nil, ctx.Err()
 	case <-done:
 	}
 
-	return result, err
+	return results, err
 }
 
 type GroupTCP struct {
 	clients []*TCP
 }
 
-func NewGroupTCP(address string, logger zerolog.Logger, readTimeout time.Duration, count int) (c *GroupTCP, cl func(), err error) {
+func NewGroupTCP(address string, logger zerolog.Logger, readTimeout time.Duration, maxMessageSize int, tlsConfig *tls.Config, count int) (c *GroupTCP, cl func(), err error) {
 	cls := make([]func(), 0, count)
 	clients := make([]*TCP, 0, count)
 	for range count {
-		client, cl, err := NewClientTCP(address, logger, readTimeout)
+		client, cl, err := NewClientTCP(address, logger, readTimeout, maxMessageSize, tlsConfig)
 		if err != nil {
 			for _, cl := range cls {
 				cl()
@@ -116,8 +184,8 @@ func (c GroupTCP) Query(ctx context.Context, query string) (string, error) {
 	done := make(chan resp, len(c.clients))
 	wg := sync.WaitGroup{}
 	for _, client := range c.clients {
+		wg.Add(1)
 		go func() {
-			wg.Add(1)
 			defer wg.Done()
 
 			r, err := client.Query(ctx, query)
@@ -129,6 +197,7 @@ func (c GroupTCP) Query(ctx context.Context, query string) (string, error) {
 	}
 
 	wg.Wait()
+	close(done)
 
 	var lastErr error
 	for r := range done {
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"key-value-storage/internal"
+)
+
+// withQueryTimeout ограничивает ожидание ответов на запросы. Блокирующая команда ждет на сервере
+// свой таймаут, поэтому он добавляется к readTimeout, а BLPOP без таймаута ждет без ограничения
+func withQueryTimeout(ctx context.Context, readTimeout time.Duration, queries ...[]string) (context.Context, context.CancelFunc) {
+	timeout := readTimeout
+	for _, args := range queries {
+		if len(args) != 3 || !strings.EqualFold(args[0], string(internal.BLPop)) {
+			continue
+		}
+
+		seconds, err := strconv.ParseFloat(args[2], 64)
+		if err != nil {
+			continue
+		}
+		if seconds == 0 {
+			return context.WithCancel(ctx)
+		}
+		timeout += time.Duration(seconds * float64(time.Second))
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
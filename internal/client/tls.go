@@ -0,0 +1,62 @@
+package client
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"key-value-storage/internal"
+)
+
+// TLSOptions настройки TLS клиента
+type TLSOptions struct {
+	// CAFile корневой сертификат сервера, без него используются системные
+	CAFile string
+	// CertFile и KeyFile сертификат клиента для mTLS
+	CertFile string
+	KeyFile  string
+	// ServerName имя сервера в сертификате, по умолчанию хост из адреса
+	ServerName string
+}
+
+// NewTLSConfig создает настройки TLS клиента
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: opts.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if opts.CAFile != "" {
+		pool, err := internal.LoadCertPool(opts.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load ca")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// dial подключается к серверу, с TLS если задан tlsConfig.
+// Адрес вида unix:///path/to/socket подключает к Unix-сокету, TLS для него не используется
+func dial(address string, tlsConfig *tls.Config) (net.Conn, error) {
+	if path, ok := strings.CutPrefix(address, internal.UnixScheme); ok {
+		return net.Dial("unix", path)
+	}
+
+	if tlsConfig == nil {
+		return net.Dial("tcp", address)
+	}
+
+	return tls.Dial("tcp", address, tlsConfig)
+}
@@ -1,33 +1,169 @@
 package internal
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/pkg/errors"
 )
 
 type CommandType string
 
 const (
-	Get CommandType = "GET"
-	Set CommandType = "SET"
-	Del CommandType = "DEL"
+	Get  CommandType = "GET"
+	Set  CommandType = "SET"
+	Del  CommandType = "DEL"
+	MGet CommandType = "MGET"
+	MSet CommandType = "MSET"
+	MDel CommandType = "MDEL"
+
+	Incr        CommandType = "INCR"
+	Decr        CommandType = "DECR"
+	IncrBy      CommandType = "INCRBY"
+	IncrByFloat CommandType = "INCRBYFLOAT"
+
+	Type CommandType = "TYPE"
+
+	HSet    CommandType = "HSET"
+	HGet    CommandType = "HGET"
+	HDel    CommandType = "HDEL"
+	HGetAll CommandType = "HGETALL"
+	HKeys   CommandType = "HKEYS"
+
+	LPush  CommandType = "LPUSH"
+	RPush  CommandType = "RPUSH"
+	LPop   CommandType = "LPOP"
+	RPop   CommandType = "RPOP"
+	LRange CommandType = "LRANGE"
+	LLen   CommandType = "LLEN"
+	BLPop  CommandType = "BLPOP"
+
+	SAdd      CommandType = "SADD"
+	SRem      CommandType = "SREM"
+	SMembers  CommandType = "SMEMBERS"
+	SIsMember CommandType = "SISMEMBER"
+	SInter    CommandType = "SINTER"
+	SUnion    CommandType = "SUNION"
+
+	ZAdd          CommandType = "ZADD"
+	ZRange        CommandType = "ZRANGE"
+	ZRangeByScore CommandType = "ZRANGEBYSCORE"
+	ZRank         CommandType = "ZRANK"
+	ZRem          CommandType = "ZREM"
+
+	Keys CommandType = "KEYS"
+	Scan CommandType = "SCAN"
+
+	Select  CommandType = "SELECT"
+	FlushDB CommandType = "FLUSHDB"
+	Info    CommandType = "INFO"
+
+	Exists   CommandType = "EXISTS"
+	Rename   CommandType = "RENAME"
+	Copy     CommandType = "COPY"
+	DBSize   CommandType = "DBSIZE"
+	FlushAll CommandType = "FLUSHALL"
+
+	Append   CommandType = "APPEND"
+	StrLen   CommandType = "STRLEN"
+	GetRange CommandType = "GETRANGE"
+	SetRange CommandType = "SETRANGE"
+	GetSet   CommandType = "GETSET"
+	GetDel   CommandType = "GETDEL"
+	SetNX    CommandType = "SETNX"
+
+	Ping CommandType = "PING"
+	Auth CommandType = "AUTH"
+	ACL  CommandType = "ACL"
+
+	Publish      CommandType = "PUBLISH"
+	Subscribe    CommandType = "SUBSCRIBE"
+	PSubscribe   CommandType = "PSUBSCRIBE"
+	Unsubscribe  CommandType = "UNSUBSCRIBE"
+	PUnsubscribe CommandType = "PUNSUBSCRIBE"
+
+	SlowLog CommandType = "SLOWLOG"
+)
+
+// CopyReplace опция COPY для перезаписи существующего ключа
+const CopyReplace = "REPLACE"
+
+// опции SCAN
+const (
+	ScanMatch = "MATCH"
+	ScanCount = "COUNT"
 )
 
 type Command struct {
 	Type CommandType
 	Args []string
+	// Namespace пространство ключей, заполняется при записи в журнал
+	Namespace string
 }
 
 func (c Command) validate() error {
 	var msg string
 	switch c.Type {
-	case Get, Del:
+	case FlushDB, Info, DBSize, FlushAll, Ping:
+		if len(c.Args) != 0 {
+			msg = "args count must be 0"
+		}
+	case Get, Del, Incr, Decr, Type, HGetAll, HKeys, LPop, RPop, LLen, SMembers, Keys, Select, StrLen, GetDel:
 		if len(c.Args) != 1 {
 			msg = "args count must be 1"
 		}
+	case Auth:
+		if len(c.Args) != 1 && len(c.Args) != 2 {
+			msg = "args count must be 1 or 2"
+		}
+	case ACL:
+		if len(c.Args) != 1 || !strings.EqualFold(c.Args[0], ACLWhoAmI) && !strings.EqualFold(c.Args[0], ACLList) {
+			msg = "acl subcommand must be WHOAMI or LIST"
+		}
+	case SlowLog:
+		msg = c.validateSlowLog()
 	case Set:
+		if len(c.Args) == 3 && c.Args[2] != string(SetIfNotExists) && c.Args[2] != string(SetIfExists) {
+			msg = "unknown set option " + c.Args[2]
+		} else if len(c.Args) != 2 && len(c.Args) != 3 {
+			msg = "args count must be 2 or 3"
+		}
+	case IncrBy, IncrByFloat, HGet, BLPop, SIsMember, ZRank, Rename, Append, GetSet, SetNX, Publish:
 		if len(c.Args) != 2 {
 			msg = "args count must be 2"
 		}
+	case LRange, ZRange, ZRangeByScore, GetRange, SetRange:
+		if len(c.Args) != 3 {
+			msg = "args count must be 3"
+		}
+	case MGet, MDel, SInter, SUnion, Exists, Subscribe, PSubscribe:
+		if len(c.Args) == 0 {
+			msg = "args count must be at least 1"
+		}
+	case MSet:
+		if len(c.Args) == 0 || len(c.Args)%2 != 0 {
+			msg = "args count must be even and at least 2"
+		}
+	case HSet, ZAdd:
+		if len(c.Args) < 3 || len(c.Args)%2 != 1 {
+			msg = "args count must be odd and at least 3"
+		}
+	case Copy:
+		if len(c.Args) == 3 && c.Args[2] != CopyReplace {
+			msg = "unknown copy option " + c.Args[2]
+		} else if len(c.Args) != 2 && len(c.Args) != 3 {
+			msg = "args count must be 2 or 3"
+		} else if c.Args[0] == c.Args[1] {
+			msg = "source and destination keys must differ"
+		}
+	case Scan:
+		if len(c.Args)%2 != 1 || len(c.Args) > 5 {
+			msg = "args count must be 1, 3 or 5"
+		}
+	case HDel, LPush, RPush, SAdd, SRem, ZRem:
+		if len(c.Args) < 2 {
+			msg = "args count must be at least 2"
+		}
 	}
 
 	if msg != "" {
@@ -36,3 +172,106 @@ func (c Command) validate() error {
 
 	return nil
 }
+
+func (c Command) validateSlowLog() string {
+	if len(c.Args) == 0 {
+		return "slowlog subcommand must be GET, LEN or RESET"
+	}
+
+	switch strings.ToUpper(c.Args[0]) {
+	case SlowLogGet:
+		if len(c.Args) > 2 {
+			return "args count must be 1 or 2"
+		}
+		if len(c.Args) == 2 {
+			if n, err := strconv.Atoi(c.Args[1]); err != nil || n < 0 {
+				return "slowlog count must be a non-negative integer"
+			}
+		}
+	case SlowLogLen, SlowLogReset:
+		if len(c.Args) != 1 {
+			return "args count must be 1"
+		}
+	default:
+		return "slowlog subcommand must be GET, LEN or RESET"
+	}
+
+	return ""
+}
+
+// isWrite сообщает, что команда изменяет данные
+func (c Command) isWrite() bool {
+	switch c.Type {
+	case Set, Del, MSet, MDel, Incr, Decr, IncrBy, IncrByFloat,
+		HSet, HDel, LPush, RPush, LPop, RPop, BLPop, SAdd, SRem, ZAdd, ZRem,
+		FlushDB, FlushAll, Rename, Copy, Append, SetRange, GetSet, GetDel, SetNX:
+		return true
+	case SlowLog:
+		return strings.EqualFold(c.Args[0], SlowLogReset)
+	default:
+		return false
+	}
+}
+
+// isBlocking сообщает, что команда может ждать событий, поэтому ее время не попадает в журнал медленных запросов
+func (c Command) isBlocking() bool {
+	switch c.Type {
+	case BLPop, Subscribe, PSubscribe:
+		return true
+	default:
+		return false
+	}
+}
+
+// isConcurrent сообщает, что команда только читает данные и не меняет состояние сессии,
+// такие запросы одного соединения можно выполнять параллельно
+func isConcurrent(name string) bool {
+	switch CommandType(strings.ToUpper(name)) {
+	case Get, MGet, Type, HGet, HGetAll, HKeys, LRange, LLen, SMembers, SIsMember, SInter, SUnion,
+		ZRange, ZRangeByScore, ZRank, Keys, Scan, Info, Exists, DBSize, StrLen, GetRange, Ping:
+		return true
+	default:
+		return false
+	}
+}
+
+// repliesNilOnMiss проверяет, отвечает ли команда nil на отсутствующее значение.
+// У остальных команд отсутствие ключа остается ошибкой
+func repliesNilOnMiss(name string) bool {
+	switch CommandType(strings.ToUpper(name)) {
+	case Get, HGet, LPop, RPop, BLPop, GetDel, ZRank:
+		return true
+	default:
+		return false
+	}
+}
+
+// keyArgs возвращает ключи, с которыми работает команда.
+// false означает, что команда работает со всем пространством ключей
+func (c Command) keyArgs() ([]string, bool) {
+	switch c.Type {
+	case Keys, Scan, FlushDB, FlushAll, DBSize, Info, SlowLog:
+		return nil, false
+	case MGet, MDel, SInter, SUnion, Exists:
+		return c.Args, true
+	case MSet:
+		keys := make([]string, 0, len(c.Args)/2)
+		for i := 0; i < len(c.Args); i += 2 {
+			keys = append(keys, c.Args[i])
+		}
+		return keys, true
+	case Rename, Copy:
+		return c.Args[:2], true
+	case Publish:
+		// подделанное событие канала уведомлений так же опасно, как подписка на него
+		return channelKeys(c.Args[:1], false)
+	case Subscribe:
+		return channelKeys(c.Args, false)
+	case PSubscribe:
+		return channelKeys(c.Args, true)
+	case Select, Ping, Auth, ACL, Unsubscribe, PUnsubscribe:
+		return nil, true
+	default:
+		return c.Args[:1], true
+	}
+}
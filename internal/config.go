@@ -18,10 +18,25 @@ type EngineConfig struct {
 
 // NetworkConfig представляет конфигурацию сети
 type NetworkConfig struct {
-	MaxConnections int           `yaml:"max_connections" mapstructure:"max_connections"`
+	MaxConnections int `yaml:"max_connections" mapstructure:"max_connections"`
+	// AcceptQueue число соединений, ожидающих освобождения места при MaxConnections,
+	// AcceptTimeout время ожидания, после которого соединение отклоняется
+	AcceptQueue    int           `yaml:"accept_queue" mapstructure:"accept_queue"`
+	AcceptTimeout  time.Duration `yaml:"accept_timeout" mapstructure:"accept_timeout"`
 	MaxMessageSize int           `yaml:"max_message_size" mapstructure:"max_message_size"`
 	IdleTimeout    time.Duration `yaml:"idle_timeout" mapstructure:"idle_timeout"`
 	Address        net.TCPAddr   `yaml:"address" mapstructure:"address"`
+	// DrainTimeout время на завершение выполняемых запросов при остановке
+	DrainTimeout time.Duration `yaml:"drain_timeout" mapstructure:"drain_timeout"`
+	TLS          TLSConfig     `yaml:"tls" mapstructure:"tls"`
+	// UnixSocket обслуживает тот же протокол через Unix-сокет, DisableTCP оставляет только его
+	UnixSocket UnixSocketConfig `yaml:"unix_socket" mapstructure:"unix_socket"`
+	DisableTCP bool             `yaml:"disable_tcp" mapstructure:"disable_tcp"`
+	// HTTP шлюз запускается вместе с основным режимом и использует те же TLS, ограничения и пользователей
+	HTTP HTTPConfig `yaml:"http" mapstructure:"http"`
+	// RateLimit ограничения частоты запросов клиентов
+	RateLimit RateLimitConfig `yaml:"rate_limit" mapstructure:"rate_limit"`
+	Admin     AdminConfig     `yaml:"admin" mapstructure:"admin"`
 }
 
 const ConsoleLogOutput = "console"
@@ -56,4 +71,9 @@ type Config struct {
 	Network NetworkConfig `yaml:"network"`
 	Logging LoggingConfig `yaml:"logging"`
 	Wal     WalConfig     `yaml:"wal"`
+	Auth    AuthConfig    `yaml:"auth"`
+	PubSub  PubSubConfig  `yaml:"pubsub"`
+	// Notifications события изменения ключей, публикуются через pub/sub
+	Notifications NotificationsConfig `yaml:"notifications"`
+	SlowLog       SlowLogConfig       `yaml:"slowlog"`
 }
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"time"
+)
+
+// AdminConfig отдельный слушатель для операторов со своим пределом соединений,
+// чтобы подключиться можно было и при исчерпании MaxConnections. Включается, если задан адрес
+type AdminConfig struct {
+	Address        string `yaml:"address" mapstructure:"address"`
+	MaxConnections int    `yaml:"max_connections" mapstructure:"max_connections"`
+}
+
+func (c AdminConfig) Enabled() bool {
+	return c.Address != ""
+}
+
+// connLimiter семафор соединений с ограниченной очередью ожидания свободного места
+type connLimiter struct {
+	slots   chan struct{}
+	waiting chan struct{}
+	timeout time.Duration
+}
+
+func newConnLimiter(maxConnections, queueSize int, timeout time.Duration) *connLimiter {
+	return &connLimiter{
+		slots:   make(chan struct{}, max(maxConnections, 0)),
+		waiting: make(chan struct{}, max(queueSize, 0)),
+		timeout: timeout,
+	}
+}
+
+// acquire занимает место для соединения. Если мест нет, соединение ждет в очереди
+// не дольше timeout, при заполненной очереди отклоняется сразу.
+// queued сообщает, пришлось ли ждать
+func (l *connLimiter) acquire(stopping <-chan struct{}) (ok bool, queued bool) {
+	select {
+	case l.slots <- struct{}{}:
+		return true, false
+	default:
+	}
+
+	select {
+	case l.waiting <- struct{}{}:
+		defer func() { <-l.waiting }()
+	default:
+		return false, false
+	}
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return true, true
+	case <-timer.C:
+		return false, true
+	case <-stopping:
+		return false, true
+	}
+}
+
+func (l *connLimiter) release() {
+	<-l.slots
+}
+
+// active возвращает число занятых мест
+func (l *connLimiter) active() int {
+	return len(l.slots)
+}
@@ -0,0 +1,87 @@
+package internal_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+)
+
+func TestServerTCP_AcceptQueue(t *testing.T) {
+	logger := zerolog.Nop()
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := freeAddress(t)
+	adminAddress := freeAddress(t)
+	server := internal.NewServerTCP(internal.NetworkConfig{
+		MaxConnections: 1,
+		AcceptQueue:    1,
+		AcceptTimeout:  300 * time.Millisecond,
+		IdleTimeout:    time.Minute,
+		Address:        address,
+		Admin:          internal.AdminConfig{Address: adminAddress.String(), MaxConnections: 1},
+	}, internal.NewDB(internal.NewParser(logger), storage, logger), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = server.Run(ctx) }()
+	time.Sleep(100 * time.Millisecond)
+
+	ping := func(address string) (net.Conn, string) {
+		t.Helper()
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err = conn.Write([]byte("PING\n")); err != nil {
+			t.Fatal(err)
+		}
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+
+		return conn, line
+	}
+
+	first, line := ping(address.String())
+	if line != "+PONG\n" {
+		t.Fatalf("expected PONG, got %q", line)
+	}
+
+	// место занято, второй клиент ждет в очереди и отклоняется по таймауту
+	rejected, line := ping(address.String())
+	rejected.Close()
+	if !strings.HasPrefix(line, "-TOO_MANY_CONNECTIONS") {
+		t.Fatalf("expected rejection after accept timeout, got %q", line)
+	}
+
+	// операторы подключаются, даже когда основные места заняты
+	admin, line := ping(adminAddress.String())
+	admin.Close()
+	if line != "+PONG\n" {
+		t.Fatalf("expected admin PONG, got %q", line)
+	}
+
+	// освободившееся место достается клиенту из очереди
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		first.Close()
+	}()
+	queued, line := ping(address.String())
+	queued.Close()
+	if line != "+PONG\n" {
+		t.Fatalf("expected queued client to be served, got %q", line)
+	}
+
+	if stats := server.Stats(); stats.Queued != 2 || stats.Rejected != 1 {
+		t.Errorf("expected 2 queued and 1 rejected connections, got %+v", stats)
+	}
+}
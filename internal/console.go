@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"io"
 	"os"
 )
 
@@ -19,6 +21,11 @@ func NewConsole(db iDB, logger zerolog.Logger) *Console {
 
 func (c *Console) Run(ctx context.Context) error {
 	reader := bufio.NewReader(os.Stdin)
+	// консоль запускается локально, поэтому AUTH не требуется
+	session := NewSession()
+	session.SetUser(DefaultUser)
+	session.Trust()
+	ctx = ContextWithSession(ctx, session)
 
 	c.logger.Info().Msg("run console mode")
 	fmt.Println("Вводите запросы к БД или напишите 'exit' для завершение работы")
@@ -28,7 +35,25 @@ func (c *Console) Run(ctx context.Context) error {
 	}()
 	for {
 		fmt.Println("Введите строку: ")
-		input, err := reader.ReadString('\n')
+
+		// чтение stdin не прерывается, поэтому остановку ждем параллельно
+		var input string
+		var err error
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			input, err = reader.ReadString('\n')
+		}()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-done:
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
 		if err != nil {
 			c.logger.Err(err).Msg("on read input")
 			fmt.Println("Ошибка при чтении ввода: ", err)
@@ -2,60 +2,702 @@ package internal
 
 import (
 	"context"
+	"encoding/hex"
+	"fmt"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"time"
 )
 
+// NilValue обозначает отсутствующий ключ в ответе с несколькими значениями
+const NilValue = "(nil)"
+
+// ScanStartCursor курсор начала и окончания обхода SCAN
+const ScanStartCursor = "0"
+
+const defaultScanCount = 10
+
+// EmptyString ответ с пустой строкой, чтобы его нельзя было спутать с "ok"
+const EmptyString = `""`
+
+// EmptyList ответ с пустым списком значений
+const EmptyList = "(empty)"
+
+// ValuesDelim разделяет значения в ответе с несколькими значениями
+const ValuesDelim = " "
+
 type iParser interface {
 	Parse(string) (Command, error)
+	ParseArgs([]string) (Command, error)
 }
 
 type iStorage interface {
 	Set(context.Context, string, string) error
 	Get(context.Context, string) (string, error)
 	Del(context.Context, string) error
+	MGet(context.Context, []string) ([]string, []bool, error)
+	MSet(context.Context, []string) error
+	MDel(context.Context, []string) (int, error)
+	IncrBy(context.Context, string, int64) (int64, error)
+	IncrByFloat(context.Context, string, float64) (float64, error)
+	Type(context.Context, string) (ValueType, error)
+	HSet(context.Context, string, []string) (int, error)
+	HGet(context.Context, string, string) (string, error)
+	HDel(context.Context, string, []string) (int, error)
+	HGetAll(context.Context, string) ([]string, error)
+	HKeys(context.Context, string) ([]string, error)
+	LPush(context.Context, string, []string) (int, error)
+	RPush(context.Context, string, []string) (int, error)
+	LPop(context.Context, string) (string, error)
+	RPop(context.Context, string) (string, error)
+	BLPop(context.Context, string, time.Duration) (string, error)
+	LRange(context.Context, string, int, int) ([]string, error)
+	LLen(context.Context, string) (int, error)
+	SAdd(context.Context, string, []string) (int, error)
+	SRem(context.Context, string, []string) (int, error)
+	SMembers(context.Context, string) ([]string, error)
+	SIsMember(context.Context, string, string) (bool, error)
+	SInter(context.Context, []string) ([]string, error)
+	SUnion(context.Context, []string) ([]string, error)
+	ZAdd(context.Context, string, []ScoredMember) (int, error)
+	ZRem(context.Context, string, []string) (int, error)
+	ZRange(context.Context, string, int, int) ([]ScoredMember, error)
+	ZRangeByScore(context.Context, string, float64, float64) ([]ScoredMember, error)
+	ZRank(context.Context, string, string) (int, error)
+	Keys(context.Context, string) ([]string, error)
+	Scan(context.Context, string, string, int) (string, []string, error)
+	FlushDB(context.Context) error
+	NamespaceSizes(context.Context) (map[string]int, error)
+	FlushAll(context.Context) error
+	Exists(context.Context, []string) (int, error)
+	DBSize(context.Context) (int, error)
+	Rename(context.Context, string, string) error
+	Copy(context.Context, string, string, bool) (bool, error)
+	SetIf(context.Context, string, string, SetCondition) (bool, error)
+	Append(context.Context, string, string) (int, error)
+	StrLen(context.Context, string) (int, error)
+	GetRange(context.Context, string, int, int) (string, error)
+	SetRange(context.Context, string, int, string) (int, error)
+	GetSet(context.Context, string, string) (string, bool, error)
+	GetDel(context.Context, string) (string, error)
 }
 
 type DB struct {
 	parser  iParser
 	storage iStorage
-	logger  zerolog.Logger
+	// auth проверяет пароли AUTH, nil если пользователи не настроены
+	auth *Authenticator
+	// broker рассылает сообщения PUBLISH, nil если pub/sub выключен
+	broker *Broker
+	// slowLog журнал медленных запросов, nil если он выключен
+	slowLog *SlowQueryLog
+	// stats счетчики серверов для INFO, nil в консоли
+	stats  *ServerCounters
+	logger zerolog.Logger
+}
+
+// DBOption подключает к базе необязательную возможность
+type DBOption func(db *DB)
+
+// WithAuth требует AUTH и проверяет права пользователей
+func WithAuth(auth *Authenticator) DBOption {
+	return func(db *DB) { db.auth = auth }
+}
+
+// WithBroker включает PUBLISH и подписки
+func WithBroker(broker *Broker) DBOption {
+	return func(db *DB) { db.broker = broker }
+}
+
+// WithSlowLog включает журнал медленных запросов
+func WithSlowLog(slowLog *SlowQueryLog) DBOption {
+	return func(db *DB) { db.slowLog = slowLog }
 }
 
-func NewDB(parser iParser, storage iStorage, logger zerolog.Logger) *DB {
-	return &DB{
+// WithServerStats добавляет в INFO счетчики соединений и ограничений частоты серверов
+func WithServerStats(stats *ServerCounters) DBOption {
+	return func(db *DB) { db.stats = stats }
+}
+
+func NewDB(parser iParser, storage iStorage, logger zerolog.Logger, opts ...DBOption) *DB {
+	db := &DB{
 		parser:  parser,
 		storage: storage,
 		logger:  logger,
 	}
+	for _, opt := range opts {
+		opt(db)
+	}
+
+	return db
 }
 
+// Query выполняет запрос текстового протокола и возвращает ответ одной строкой
 func (db *DB) Query(ctx context.Context, query string) (string, error) {
 	command, err := db.parser.Parse(query)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to parse command")
 	}
 
-	var resp string
+	reply, err := db.exec(ctx, command)
+	if err != nil {
+		return "", err
+	}
+
+	return reply.String(), nil
+}
+
+// QueryArgs выполняет запрос, уже разбитый на аргументы, и возвращает типизированный ответ
+func (db *DB) QueryArgs(ctx context.Context, args []string) (Reply, error) {
+	command, err := db.parser.ParseArgs(args)
+	if err != nil {
+		return Reply{}, errors.Wrap(err, "failed to parse command")
+	}
+
+	return db.exec(ctx, command)
+}
+
+func (db *DB) exec(ctx context.Context, command Command) (Reply, error) {
+	// соединение без пользователя может выполнить только AUTH
+	if command.Type != Auth && db.auth != nil && db.auth.Enabled() {
+		if session := SessionFromContext(ctx); session != nil && session.User() == "" {
+			return Reply{}, ErrAuthRequired
+		}
+	}
+	if err := db.checkACL(ctx, command); err != nil {
+		return Reply{}, err
+	}
+	if err := checkPushMode(ctx, command); err != nil {
+		return Reply{}, err
+	}
+	if db.slowLog != nil && !command.isBlocking() {
+		defer db.slowLog.record(ctx, command, time.Now())
+	}
+
+	var reply Reply
+	var err error
 	switch command.Type {
 	case Get:
-		resp, err = db.storage.Get(ctx, command.Args[0])
+		val, err := db.storage.Get(ctx, command.Args[0])
 		if err != nil {
-			return "", errors.Wrap(err, "failed to get value")
+			return Reply{}, errors.Wrap(err, "failed to get value")
 		}
+		reply = stringReply(val)
 	case Set:
+		if len(command.Args) == 3 {
+			isSet, err := db.storage.SetIf(ctx, command.Args[0], command.Args[1], SetCondition(command.Args[2]))
+			if err != nil {
+				return Reply{}, errors.Wrap(err, "failed to set value")
+			}
+			if !isSet {
+				return nilReply(), nil
+			}
+			return okReply(), nil
+		}
+
 		err = db.storage.Set(ctx, command.Args[0], command.Args[1])
 		if err != nil {
-			return "", errors.Wrap(err, "failed to set value")
+			return Reply{}, errors.Wrap(err, "failed to set value")
 		}
-		resp = "ok"
+		reply = okReply()
 	case Del:
 		err = db.storage.Del(ctx, command.Args[0])
 		if err != nil {
-			return "", errors.Wrap(err, "failed to delete value")
+			return Reply{}, errors.Wrap(err, "failed to delete value")
+		}
+		reply = okReply()
+	case MGet:
+		values, has, err := db.storage.MGet(ctx, command.Args)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get values")
+		}
+		reply = valuesReply(values, has)
+	case MSet:
+		err = db.storage.MSet(ctx, command.Args)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to set values")
+		}
+		reply = okReply()
+	case MDel:
+		deleted, err := db.storage.MDel(ctx, command.Args)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to delete values")
+		}
+		reply = intReply(int64(deleted))
+	case Incr, Decr, IncrBy:
+		delta, err := incrDelta(command)
+		if err != nil {
+			return Reply{}, err
+		}
+		result, err := db.storage.IncrBy(ctx, command.Args[0], delta)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to increment value")
+		}
+		reply = intReply(result)
+	case IncrByFloat:
+		delta, err := strconv.ParseFloat(command.Args[1], 64)
+		if err != nil {
+			return Reply{}, errors.Wrap(ErrInvalidCommand, "increment must be a float")
+		}
+		result, err := db.storage.IncrByFloat(ctx, command.Args[0], delta)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to increment value")
+		}
+		reply = stringReply(FormatFloat(result))
+	case Type:
+		valueType, err := db.storage.Type(ctx, command.Args[0])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get type")
+		}
+		reply = statusReply(string(valueType))
+	case HSet:
+		added, err := db.storage.HSet(ctx, command.Args[0], command.Args[1:])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to set hash fields")
+		}
+		reply = intReply(int64(added))
+	case HGet:
+		val, err := db.storage.HGet(ctx, command.Args[0], command.Args[1])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get hash field")
+		}
+		reply = stringReply(val)
+	case HDel:
+		deleted, err := db.storage.HDel(ctx, command.Args[0], command.Args[1:])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to delete hash fields")
+		}
+		reply = intReply(int64(deleted))
+	case HGetAll:
+		pairs, err := db.storage.HGetAll(ctx, command.Args[0])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get hash")
+		}
+		reply = mapReply(pairs)
+	case HKeys:
+		fields, err := db.storage.HKeys(ctx, command.Args[0])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get hash fields")
+		}
+		reply = listReply(fields)
+	case LPush:
+		length, err := db.storage.LPush(ctx, command.Args[0], command.Args[1:])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to push values")
+		}
+		reply = intReply(int64(length))
+	case RPush:
+		length, err := db.storage.RPush(ctx, command.Args[0], command.Args[1:])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to push values")
+		}
+		reply = intReply(int64(length))
+	case LPop:
+		val, err := db.storage.LPop(ctx, command.Args[0])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to pop value")
+		}
+		reply = stringReply(val)
+	case RPop:
+		val, err := db.storage.RPop(ctx, command.Args[0])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to pop value")
+		}
+		reply = stringReply(val)
+	case BLPop:
+		timeout, err := parseTimeout(command.Args[1])
+		if err != nil {
+			return Reply{}, err
+		}
+		val, err := db.storage.BLPop(ctx, command.Args[0], timeout)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to pop value")
+		}
+		reply = stringReply(val)
+	case LRange:
+		start, err := strconv.Atoi(command.Args[1])
+		if err != nil {
+			return Reply{}, errors.Wrap(ErrInvalidCommand, "start must be an integer")
+		}
+		stop, err := strconv.Atoi(command.Args[2])
+		if err != nil {
+			return Reply{}, errors.Wrap(ErrInvalidCommand, "stop must be an integer")
+		}
+		values, err := db.storage.LRange(ctx, command.Args[0], start, stop)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get range")
+		}
+		reply = listReply(values)
+	case LLen:
+		length, err := db.storage.LLen(ctx, command.Args[0])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get length")
+		}
+		reply = intReply(int64(length))
+	case SAdd:
+		added, err := db.storage.SAdd(ctx, command.Args[0], command.Args[1:])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to add members")
+		}
+		reply = intReply(int64(added))
+	case SRem:
+		removed, err := db.storage.SRem(ctx, command.Args[0], command.Args[1:])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to remove members")
+		}
+		reply = intReply(int64(removed))
+	case SMembers:
+		members, err := db.storage.SMembers(ctx, command.Args[0])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get members")
+		}
+		reply = listReply(members)
+	case SIsMember:
+		isMember, err := db.storage.SIsMember(ctx, command.Args[0], command.Args[1])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to check member")
+		}
+		reply = boolReply(isMember)
+	case SInter:
+		members, err := db.storage.SInter(ctx, command.Args)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to intersect sets")
+		}
+		reply = listReply(members)
+	case SUnion:
+		members, err := db.storage.SUnion(ctx, command.Args)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to union sets")
+		}
+		reply = listReply(members)
+	case ZAdd:
+		members, err := parseScoredMembers(command.Args[1:])
+		if err != nil {
+			return Reply{}, err
+		}
+		added, err := db.storage.ZAdd(ctx, command.Args[0], members)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to add members")
+		}
+		reply = intReply(int64(added))
+	case ZRem:
+		removed, err := db.storage.ZRem(ctx, command.Args[0], command.Args[1:])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to remove members")
+		}
+		reply = intReply(int64(removed))
+	case ZRange:
+		start, err := strconv.Atoi(command.Args[1])
+		if err != nil {
+			return Reply{}, errors.Wrap(ErrInvalidCommand, "start must be an integer")
+		}
+		stop, err := strconv.Atoi(command.Args[2])
+		if err != nil {
+			return Reply{}, errors.Wrap(ErrInvalidCommand, "stop must be an integer")
 		}
-		resp = "ok"
+		members, err := db.storage.ZRange(ctx, command.Args[0], start, stop)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get range")
+		}
+		reply = membersReply(members)
+	case ZRangeByScore:
+		minScore, err := parseScore(command.Args[1])
+		if err != nil {
+			return Reply{}, err
+		}
+		maxScore, err := parseScore(command.Args[2])
+		if err != nil {
+			return Reply{}, err
+		}
+		members, err := db.storage.ZRangeByScore(ctx, command.Args[0], minScore, maxScore)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get range")
+		}
+		reply = membersReply(members)
+	case ZRank:
+		rank, err := db.storage.ZRank(ctx, command.Args[0], command.Args[1])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get rank")
+		}
+		reply = intReply(int64(rank))
+	case Keys:
+		keys, err := db.storage.Keys(ctx, command.Args[0])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get keys")
+		}
+		reply = listReply(keys)
+	case Scan:
+		cursor, pattern, count, err := parseScanArgs(command.Args)
+		if err != nil {
+			return Reply{}, err
+		}
+		next, keys, err := db.storage.Scan(ctx, cursor, pattern, count)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to scan keys")
+		}
+		// первым значением ответа идет курсор следующего вызова
+		reply = arrayReply(stringReply(encodeScanCursor(next)), listReply(keys))
+	case Select:
+		session := SessionFromContext(ctx)
+		if session == nil {
+			return Reply{}, errors.Wrap(ErrInvalidCommand, "select requires a connection session")
+		}
+		if len(command.Args[0]) > maxNamespaceLength {
+			return Reply{}, errors.Wrapf(ErrInvalidCommand, "namespace name exceeds %d bytes", maxNamespaceLength)
+		}
+		session.Select(command.Args[0])
+		reply = okReply()
+	case FlushDB:
+		if err = db.storage.FlushDB(ctx); err != nil {
+			return Reply{}, errors.Wrap(err, "failed to flush namespace")
+		}
+		reply = okReply()
+	case Info:
+		reply, err = db.info(ctx)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get info")
+		}
+	case Exists:
+		count, err := db.storage.Exists(ctx, command.Args)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to check keys")
+		}
+		reply = intReply(int64(count))
+	case Rename:
+		if err = db.storage.Rename(ctx, command.Args[0], command.Args[1]); err != nil {
+			return Reply{}, errors.Wrap(err, "failed to rename key")
+		}
+		reply = okReply()
+	case Copy:
+		replace := len(command.Args) == 3
+		copied, err := db.storage.Copy(ctx, command.Args[0], command.Args[1], replace)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to copy key")
+		}
+		reply = boolReply(copied)
+	case DBSize:
+		size, err := db.storage.DBSize(ctx)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get size")
+		}
+		reply = intReply(int64(size))
+	case FlushAll:
+		if err = db.storage.FlushAll(ctx); err != nil {
+			return Reply{}, errors.Wrap(err, "failed to flush all namespaces")
+		}
+		reply = okReply()
+	case SetNX:
+		isSet, err := db.storage.SetIf(ctx, command.Args[0], command.Args[1], SetIfNotExists)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to set value")
+		}
+		reply = boolReply(isSet)
+	case Append:
+		length, err := db.storage.Append(ctx, command.Args[0], command.Args[1])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to append value")
+		}
+		reply = intReply(int64(length))
+	case StrLen:
+		length, err := db.storage.StrLen(ctx, command.Args[0])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get length")
+		}
+		reply = intReply(int64(length))
+	case GetRange:
+		start, err := strconv.Atoi(command.Args[1])
+		if err != nil {
+			return Reply{}, errors.Wrap(ErrInvalidCommand, "start must be an integer")
+		}
+		end, err := strconv.Atoi(command.Args[2])
+		if err != nil {
+			return Reply{}, errors.Wrap(ErrInvalidCommand, "end must be an integer")
+		}
+		val, err := db.storage.GetRange(ctx, command.Args[0], start, end)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to get range")
+		}
+		reply = stringReply(val)
+	case SetRange:
+		offset, err := strconv.Atoi(command.Args[1])
+		if err != nil || offset < 0 {
+			return Reply{}, errors.Wrap(ErrInvalidCommand, "offset must be a non-negative integer")
+		}
+		if offset > maxStringSize {
+			return Reply{}, errStringTooLong
+		}
+		length, err := db.storage.SetRange(ctx, command.Args[0], offset, command.Args[2])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to set range")
+		}
+		reply = intReply(int64(length))
+	case GetSet:
+		old, has, err := db.storage.GetSet(ctx, command.Args[0], command.Args[1])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to set value")
+		}
+		reply = stringReply(old)
+		if !has {
+			reply = nilReply()
+		}
+	case GetDel:
+		val, err := db.storage.GetDel(ctx, command.Args[0])
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to delete value")
+		}
+		reply = stringReply(val)
+	case Ping:
+		reply = statusReply("PONG")
+	case Auth:
+		if err = authenticate(ctx, db.auth, command.Args); err != nil {
+			return Reply{}, errors.Wrap(err, "failed to authenticate")
+		}
+		reply = okReply()
+	case ACL:
+		reply = db.acl(ctx, command.Args[0])
+	case Publish:
+		if db.broker == nil {
+			return Reply{}, errors.Wrap(ErrInvalidCommand, "pub/sub is disabled")
+		}
+		reply = intReply(int64(db.broker.Publish(command.Args[0], command.Args[1])))
+	case Subscribe, PSubscribe, Unsubscribe, PUnsubscribe:
+		reply, err = db.subscription(ctx, command)
+		if err != nil {
+			return Reply{}, errors.Wrap(err, "failed to change subscriptions")
+		}
+	case SlowLog:
+		reply = db.slowLogReply(command.Args)
+	}
+
+	return reply, nil
+}
+
+// info возвращает сведения о сервере в виде списка поле=значение
+func (db *DB) info(ctx context.Context) (Reply, error) {
+	sizes, err := db.storage.NamespaceSizes(ctx)
+	if err != nil {
+		return Reply{}, err
+	}
+
+	fields := make([]string, 0, len(sizes))
+	for _, namespace := range slices.Sorted(maps.Keys(sizes)) {
+		fields = append(fields, fmt.Sprintf("keys.%s=%d", namespace, sizes[namespace]))
+	}
+
+	if db.stats != nil {
+		stats := db.stats.Stats()
+		fields = append(fields,
+			fmt.Sprintf("connections=%d", stats.Connections),
+			fmt.Sprintf("rejected_connections=%d", stats.Rejected),
+			fmt.Sprintf("queued_connections=%d", stats.Queued),
+			fmt.Sprintf("queries=%d", stats.Queries),
+			fmt.Sprintf("rate_limited=%d", stats.RateLimited),
+			fmt.Sprintf("delayed=%d", stats.Delayed),
+		)
+	}
+
+	return listReply(fields), nil
+}
+
+// incrDelta возвращает приращение для INCR, DECR и INCRBY
+func incrDelta(command Command) (int64, error) {
+	switch command.Type {
+	case Incr:
+		return 1, nil
+	case Decr:
+		return -1, nil
+	}
+
+	delta, err := strconv.ParseInt(command.Args[1], 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(ErrInvalidCommand, "increment must be an integer")
+	}
+
+	return delta, nil
+}
+
+// parseTimeout разбирает таймаут в секундах, 0 означает ожидание без ограничения
+func parseTimeout(arg string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(arg, 64)
+	if err != nil || seconds < 0 {
+		return 0, errors.Wrap(ErrInvalidCommand, "timeout must be a non-negative number of seconds")
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// parseScore разбирает score элемента sorted set, допускаются inf и -inf
+func parseScore(arg string) (float64, error) {
+	score, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, errors.Wrap(ErrInvalidCommand, "score must be a float")
+	}
+
+	return score, nil
+}
+
+// parseScoredMembers разбирает пары score member
+func parseScoredMembers(args []string) ([]ScoredMember, error) {
+	members := make([]ScoredMember, 0, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		score, err := parseScore(args[i])
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, ScoredMember{Score: score, Member: args[i+1]})
+	}
+
+	return members, nil
+}
+
+// parseScanArgs разбирает аргументы SCAN cursor [MATCH pattern] [COUNT count]
+func parseScanArgs(args []string) (cursor string, pattern string, count int, err error) {
+	cursor, err = decodeScanCursor(args[0])
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	pattern, count = "*", defaultScanCount
+	for i := 1; i+1 < len(args); i += 2 {
+		switch args[i] {
+		case ScanMatch:
+			pattern = args[i+1]
+		case ScanCount:
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil || count <= 0 {
+				return "", "", 0, errors.Wrap(ErrInvalidCommand, "count must be a positive integer")
+			}
+		default:
+			return "", "", 0, errors.Wrapf(ErrInvalidCommand, "unknown scan option %s", args[i])
+		}
+	}
+
+	return cursor, pattern, count, nil
+}
+
+// encodeScanCursor кодирует последний просмотренный ключ в курсор,
+// hex гарантирует что курсор не совпадет с ScanStartCursor
+func encodeScanCursor(key string) string {
+	if key == "" {
+		return ScanStartCursor
+	}
+
+	return hex.EncodeToString([]byte(key))
+}
+
+func decodeScanCursor(cursor string) (string, error) {
+	if cursor == ScanStartCursor {
+		return "", nil
+	}
+
+	key, err := hex.DecodeString(cursor)
+	if err != nil || len(key) == 0 {
+		return "", errors.Wrap(ErrInvalidCommand, "invalid cursor")
 	}
 
-	return resp, nil
+	return string(key), nil
 }
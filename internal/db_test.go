@@ -0,0 +1,421 @@
+package internal_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+)
+
+// queryCase запрос к базе и ожидаемый ответ либо код ошибки
+type queryCase struct {
+	args     []string
+	expected string
+	code     internal.ErrorCode
+}
+
+func newTestDB(t *testing.T) *internal.DB {
+	t.Helper()
+
+	logger := zerolog.Nop()
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return internal.NewDB(internal.NewParser(logger), storage, logger)
+}
+
+// runQueries выполняет запросы по порядку в одной сессии
+func runQueries(t *testing.T, db *internal.DB, cases []queryCase) {
+	t.Helper()
+
+	ctx := internal.ContextWithSession(context.Background(), internal.NewSession())
+	for _, c := range cases {
+		reply, err := db.QueryArgs(ctx, c.args)
+		if c.code != "" {
+			if code := internal.ErrorCodeOf(err); code != c.code {
+				t.Errorf("%s: expected %s error, got %v %v", strings.Join(c.args, " "), c.code, reply, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", strings.Join(c.args, " "), err)
+			continue
+		}
+		if got := reply.String(); got != c.expected {
+			t.Errorf("%s: expected %q, got %q", strings.Join(c.args, " "), c.expected, got)
+		}
+	}
+}
+
+func TestDB_Strings(t *testing.T) {
+	runQueries(t, newTestDB(t), []queryCase{
+		{args: []string{"APPEND", "s", "Hello"}, expected: "5"},
+		{args: []string{"APPEND", "s", " World"}, expected: "11"},
+		{args: []string{"STRLEN", "s"}, expected: "11"},
+		{args: []string{"STRLEN", "missing"}, expected: "0"},
+		{args: []string{"GETRANGE", "s", "0", "4"}, expected: "Hello"},
+		{args: []string{"GETRANGE", "s", "-5", "-1"}, expected: "World"},
+		{args: []string{"GETRANGE", "s", "-100", "2"}, expected: "Hel"},
+		{args: []string{"GETRANGE", "s", "6", "100"}, expected: "World"},
+		{args: []string{"GETRANGE", "s", "5", "2"}, expected: internal.EmptyString},
+		{args: []string{"GETRANGE", "missing", "0", "-1"}, expected: internal.EmptyString},
+		{args: []string{"GETRANGE", "s", "a", "1"}, code: internal.CodeSyntax},
+
+		{args: []string{"SETRANGE", "s", "6", "Redis"}, expected: "11"},
+		{args: []string{"GET", "s"}, expected: `"Hello Redis"`},
+		{args: []string{"SETRANGE", "pad", "3", "x"}, expected: "4"},
+		{args: []string{"GET", "pad"}, expected: `"\x00\x00\x00x"`},
+		{args: []string{"SETRANGE", "s", "-1", "x"}, code: internal.CodeSyntax},
+		{args: []string{"SETRANGE", "s", "536870912", "x"}, code: internal.CodeSyntax},
+		{args: []string{"SETRANGE", "s", "9223372036854775807", "a"}, code: internal.CodeSyntax},
+		{args: []string{"SETRANGE", "s", "20", ""}, expected: "11"},
+		{args: []string{"SETRANGE", "empty", "5", ""}, expected: "0"},
+		{args: []string{"EXISTS", "empty"}, expected: "0"},
+		{args: []string{"GET", "s"}, expected: `"Hello Redis"`},
+
+		{args: []string{"GETSET", "s", "new"}, expected: `"Hello Redis"`},
+		{args: []string{"GETSET", "fresh", "v"}, expected: internal.NilValue},
+		{args: []string{"GET", "fresh"}, expected: "v"},
+		{args: []string{"GETDEL", "s"}, expected: "new"},
+		{args: []string{"GET", "s"}, code: internal.CodeNotFound},
+		{args: []string{"GETDEL", "s"}, code: internal.CodeNotFound},
+
+		{args: []string{"SETNX", "nx", "1"}, expected: "1"},
+		{args: []string{"SETNX", "nx", "2"}, expected: "0"},
+		{args: []string{"GET", "nx"}, expected: "1"},
+
+		{args: []string{"SADD", "set", "a"}, expected: "1"},
+		{args: []string{"APPEND", "set", "x"}, code: internal.CodeWrongType},
+		{args: []string{"GETRANGE", "set", "0", "1"}, code: internal.CodeWrongType},
+	})
+}
+
+func TestDB_Multi(t *testing.T) {
+	runQueries(t, newTestDB(t), []queryCase{
+		{args: []string{"MSET", "a", "1", "b", "2"}, expected: "ok"},
+		{args: []string{"MGET", "a", "missing", "b"}, expected: "1 " + internal.NilValue + " 2"},
+		{args: []string{"MSET", "a", "10", "c"}, code: internal.CodeSyntax},
+		{args: []string{"MSET"}, code: internal.CodeSyntax},
+		{args: []string{"MGET"}, code: internal.CodeSyntax},
+		{args: []string{"MDEL"}, code: internal.CodeSyntax},
+		// неверная команда не меняет ни одного ключа
+		{args: []string{"GET", "a"}, expected: "1"},
+		{args: []string{"EXISTS", "c"}, expected: "0"},
+
+		{args: []string{"SADD", "set", "x"}, expected: "1"},
+		{args: []string{"MGET", "a", "set"}, expected: "1 " + internal.NilValue},
+		{args: []string{"MDEL", "a", "missing", "set"}, expected: "2"},
+		{args: []string{"MGET", "a", "b"}, expected: internal.NilValue + " 2"},
+	})
+}
+
+func TestDB_Hash(t *testing.T) {
+	runQueries(t, newTestDB(t), []queryCase{
+		{args: []string{"HSET", "h", "b", "2", "a", "1"}, expected: "2"},
+		{args: []string{"HSET", "h", "a", "10", "c", "3"}, expected: "1"},
+		{args: []string{"HSET", "h", "a"}, code: internal.CodeSyntax},
+		{args: []string{"HGET", "h", "a"}, expected: "10"},
+		{args: []string{"HGET", "h", "missing"}, code: internal.CodeNotFound},
+		{args: []string{"HGET", "missing", "a"}, code: internal.CodeNotFound},
+		{args: []string{"HGETALL", "h"}, expected: "a 10 b 2 c 3"},
+		{args: []string{"HGETALL", "missing"}, expected: internal.EmptyList},
+		{args: []string{"HKEYS", "h"}, expected: "a b c"},
+		{args: []string{"HDEL", "h", "a", "missing"}, expected: "1"},
+		{args: []string{"HDEL", "missing", "a"}, expected: "0"},
+		{args: []string{"HDEL", "h", "b", "c"}, expected: "2"},
+		// hash без полей удаляется
+		{args: []string{"EXISTS", "h"}, expected: "0"},
+		{args: []string{"TYPE", "h"}, expected: "none"},
+	})
+}
+
+func TestDB_Type(t *testing.T) {
+	runQueries(t, newTestDB(t), []queryCase{
+		{args: []string{"SET", "s", "v"}, expected: "ok"},
+		{args: []string{"HSET", "h", "f", "v"}, expected: "1"},
+		{args: []string{"RPUSH", "l", "v"}, expected: "1"},
+		{args: []string{"SADD", "set", "v"}, expected: "1"},
+		{args: []string{"ZADD", "z", "1", "v"}, expected: "1"},
+		{args: []string{"TYPE", "s"}, expected: "string"},
+		{args: []string{"TYPE", "h"}, expected: "hash"},
+		{args: []string{"TYPE", "l"}, expected: "list"},
+		{args: []string{"TYPE", "set"}, expected: "set"},
+		{args: []string{"TYPE", "z"}, expected: "zset"},
+		{args: []string{"TYPE", "missing"}, expected: "none"},
+
+		{args: []string{"HSET", "s", "f", "v"}, code: internal.CodeWrongType},
+		{args: []string{"HGET", "s", "f"}, code: internal.CodeWrongType},
+		{args: []string{"HDEL", "s", "f"}, code: internal.CodeWrongType},
+		{args: []string{"HGETALL", "s"}, code: internal.CodeWrongType},
+		{args: []string{"HKEYS", "s"}, code: internal.CodeWrongType},
+		{args: []string{"GET", "h"}, code: internal.CodeWrongType},
+		{args: []string{"APPEND", "h", "x"}, code: internal.CodeWrongType},
+		{args: []string{"INCR", "h"}, code: internal.CodeWrongType},
+		// SET перезаписывает значение любого типа
+		{args: []string{"SET", "h", "v"}, expected: "ok"},
+		{args: []string{"TYPE", "h"}, expected: "string"},
+	})
+}
+
+func TestDB_List(t *testing.T) {
+	runQueries(t, newTestDB(t), []queryCase{
+		{args: []string{"RPUSH", "l", "b", "c"}, expected: "2"},
+		{args: []string{"LPUSH", "l", "a"}, expected: "3"},
+		{args: []string{"LRANGE", "l", "0", "-1"}, expected: "a b c"},
+		{args: []string{"LRANGE", "l", "-2", "10"}, expected: "b c"},
+		{args: []string{"LRANGE", "l", "5", "10"}, expected: internal.EmptyList},
+		{args: []string{"LLEN", "l"}, expected: "3"},
+		{args: []string{"LLEN", "missing"}, expected: "0"},
+		{args: []string{"LPOP", "l"}, expected: "a"},
+		{args: []string{"RPOP", "l"}, expected: "c"},
+		{args: []string{"BLPOP", "l", "1"}, expected: "b"},
+		{args: []string{"LPOP", "l"}, code: internal.CodeNotFound},
+		{args: []string{"EXISTS", "l"}, expected: "0"},
+		{args: []string{"BLPOP", "l", "0.05"}, code: internal.CodeTimeout},
+		{args: []string{"BLPOP", "l", "-1"}, code: internal.CodeSyntax},
+		{args: []string{"SET", "s", "v"}, expected: "ok"},
+		{args: []string{"LPUSH", "s", "v"}, code: internal.CodeWrongType},
+		{args: []string{"BLPOP", "s", "0.05"}, code: internal.CodeWrongType},
+	})
+}
+
+func TestDB_BLPop(t *testing.T) {
+	db := newTestDB(t)
+	ctx := internal.ContextWithSession(context.Background(), internal.NewSession())
+
+	push := func(delay time.Duration) {
+		time.Sleep(delay)
+		if _, err := db.QueryArgs(ctx, []string{"RPUSH", "queue", "a"}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, timeout := range []string{"5", "0"} {
+		t.Run("timeout "+timeout, func(t *testing.T) {
+			go push(50 * time.Millisecond)
+
+			// нулевой timeout ждет без ограничения, пока элемент не появится
+			start := time.Now()
+			reply, err := db.QueryArgs(ctx, []string{"BLPOP", "queue", timeout})
+			if err != nil || reply.String() != "a" {
+				t.Fatalf("expected a, got %v %v", reply, err)
+			}
+			if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+				t.Errorf("expected wakeup on push, got %s", elapsed)
+			}
+		})
+	}
+
+	t.Run("disconnect", func(t *testing.T) {
+		session := internal.NewSession()
+		done := make(chan error)
+		go func() {
+			_, err := db.QueryArgs(internal.ContextWithSession(context.Background(), session), []string{"BLPOP", "queue", "0"})
+			done <- err
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+		session.Disconnect()
+		if err := <-done; err == nil {
+			t.Fatal("expected BLPOP to be interrupted")
+		}
+
+		// элемент после отключения достается следующему клиенту
+		push(0)
+		if reply, err := db.QueryArgs(ctx, []string{"LLEN", "queue"}); err != nil || reply.Int != 1 {
+			t.Fatalf("expected element to stay in list, got %v %v", reply, err)
+		}
+	})
+}
+
+func TestDB_Keys(t *testing.T) {
+	runQueries(t, newTestDB(t), []queryCase{
+		{args: []string{"MSET", "user:1", "a", "user:2", "b", "order:1", "c", "user:10", "d"}, expected: "ok"},
+		{args: []string{"KEYS", "*"}, expected: "order:1 user:1 user:10 user:2"},
+		{args: []string{"KEYS", "user:?"}, expected: "user:1 user:2"},
+		{args: []string{"KEYS", "user:*"}, expected: "user:1 user:10 user:2"},
+		{args: []string{"KEYS", "*:1*"}, expected: "order:1 user:1 user:10"},
+		{args: []string{"KEYS", "[ou]*:2"}, expected: "user:2"},
+		{args: []string{"KEYS", "missing*"}, expected: internal.EmptyList},
+		{args: []string{"SCAN", "zz"}, code: internal.CodeSyntax},
+		{args: []string{"SCAN", internal.ScanStartCursor, "COUNT", "0"}, code: internal.CodeSyntax},
+	})
+}
+
+func TestDB_Scan(t *testing.T) {
+	db := newTestDB(t)
+	ctx := internal.ContextWithSession(context.Background(), internal.NewSession())
+
+	const total = 100
+	for i := range total {
+		if _, err := db.QueryArgs(ctx, []string{"SET", "key" + strconv.Itoa(i), "v"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// между вызовами удаляются уже просмотренные ключи и ключ курсора,
+	// оставшиеся ключи должны вернуться ровно по одному разу
+	seen := make(map[string]int)
+	deleted := make(map[string]bool)
+	cursor := internal.ScanStartCursor
+	for calls := 0; ; calls++ {
+		if calls > total {
+			t.Fatal("scan did not finish")
+		}
+
+		reply, err := db.QueryArgs(ctx, []string{"SCAN", cursor, "COUNT", "7"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cursor = reply.Array[0].Str
+		keys := reply.Array[1].Array
+		for _, key := range keys {
+			seen[key.Str]++
+		}
+		if cursor == internal.ScanStartCursor {
+			break
+		}
+
+		if calls%2 == 0 && len(keys) > 0 {
+			last := keys[len(keys)-1].Str
+			if _, err = db.QueryArgs(ctx, []string{"DEL", last}); err != nil {
+				t.Fatal(err)
+			}
+			deleted[last] = true
+		}
+	}
+
+	for i := range total {
+		key := "key" + strconv.Itoa(i)
+		if seen[key] != 1 {
+			t.Errorf("key %s returned %d times", key, seen[key])
+		}
+	}
+	if len(deleted) == 0 {
+		t.Error("expected keys to be deleted during scan")
+	}
+
+	t.Run("match", func(t *testing.T) {
+		var keys []string
+		cursor := internal.ScanStartCursor
+		for {
+			reply, err := db.QueryArgs(ctx, []string{"SCAN", cursor, "MATCH", "key1*", "COUNT", "3"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range reply.Array[1].Array {
+				keys = append(keys, key.Str)
+			}
+			if cursor = reply.Array[0].Str; cursor == internal.ScanStartCursor {
+				break
+			}
+		}
+
+		for _, key := range keys {
+			if !strings.HasPrefix(key, "key1") {
+				t.Errorf("unexpected key %s", key)
+			}
+		}
+		// key1 и key10..key19 без удаленных во время обхода
+		expected := 0
+		for i := range total {
+			if key := "key" + strconv.Itoa(i); strings.HasPrefix(key, "key1") && !deleted[key] {
+				expected++
+			}
+		}
+		if len(keys) != expected {
+			t.Errorf("expected %d keys, got %v", expected, keys)
+		}
+	})
+}
+
+func TestDB_Namespaces(t *testing.T) {
+	runQueries(t, newTestDB(t), []queryCase{
+		{args: []string{"SET", "k", "default"}, expected: "ok"},
+		{args: []string{"SELECT", "team-a"}, expected: "ok"},
+		{args: []string{"GET", "k"}, code: internal.CodeNotFound},
+		{args: []string{"SET", "k", "a"}, expected: "ok"},
+		{args: []string{"SET", "other", "a"}, expected: "ok"},
+		{args: []string{"DBSIZE"}, expected: "2"},
+		{args: []string{"SELECT", "team-b"}, expected: "ok"},
+		{args: []string{"SET", "k", "b"}, expected: "ok"},
+		{args: []string{"INFO"}, expected: "keys.0=1 keys.team-a=2 keys.team-b=1"},
+
+		// чтение не создает пространство ключей
+		{args: []string{"SELECT", "ghost"}, expected: "ok"},
+		{args: []string{"GET", "k"}, code: internal.CodeNotFound},
+		{args: []string{"KEYS", "*"}, expected: internal.EmptyList},
+		{args: []string{"DEL", "k"}, expected: "ok"},
+		{args: []string{"LPOP", "k"}, code: internal.CodeNotFound},
+		{args: []string{"INFO"}, expected: "keys.0=1 keys.team-a=2 keys.team-b=1"},
+		{args: []string{"SELECT", strings.Repeat("x", 65)}, code: internal.CodeSyntax},
+
+		{args: []string{"SELECT", "team-a"}, expected: "ok"},
+		{args: []string{"GET", "k"}, expected: "a"},
+		{args: []string{"FLUSHDB"}, expected: "ok"},
+		{args: []string{"DBSIZE"}, expected: "0"},
+		{args: []string{"SELECT", "team-b"}, expected: "ok"},
+		{args: []string{"GET", "k"}, expected: "b"},
+		{args: []string{"SELECT", internal.DefaultNamespace}, expected: "ok"},
+		{args: []string{"GET", "k"}, expected: "default"},
+		{args: []string{"INFO"}, expected: "keys.0=1 keys.team-b=1"},
+
+		{args: []string{"FLUSHALL"}, expected: "ok"},
+		{args: []string{"INFO"}, expected: "keys.0=0"},
+	})
+}
+
+func TestDB_KeyManagement(t *testing.T) {
+	runQueries(t, newTestDB(t), []queryCase{
+		{args: []string{"MSET", "a", "1", "b", "2"}, expected: "ok"},
+		{args: []string{"HSET", "h", "f", "v"}, expected: "1"},
+		{args: []string{"EXISTS", "a", "b", "missing", "a"}, expected: "3"},
+		{args: []string{"EXISTS", "missing"}, expected: "0"},
+		{args: []string{"EXISTS"}, code: internal.CodeSyntax},
+		{args: []string{"DBSIZE"}, expected: "3"},
+		{args: []string{"DBSIZE", "a"}, code: internal.CodeSyntax},
+
+		{args: []string{"RENAME", "a", "c"}, expected: "ok"},
+		{args: []string{"GET", "a"}, code: internal.CodeNotFound},
+		{args: []string{"GET", "c"}, expected: "1"},
+		{args: []string{"RENAME", "c", "b"}, expected: "ok"},
+		{args: []string{"GET", "b"}, expected: "1"},
+		{args: []string{"RENAME", "h", "h2"}, expected: "ok"},
+		{args: []string{"HGET", "h2", "f"}, expected: "v"},
+		{args: []string{"RENAME", "missing", "x"}, code: internal.CodeNotFound},
+		{args: []string{"RENAME", "b"}, code: internal.CodeSyntax},
+		{args: []string{"DBSIZE"}, expected: "2"},
+
+		{args: []string{"COPY", "b", "c"}, expected: "1"},
+		{args: []string{"GET", "c"}, expected: "1"},
+		{args: []string{"SET", "b", "2"}, expected: "ok"},
+		{args: []string{"COPY", "b", "c"}, expected: "0"},
+		{args: []string{"GET", "c"}, expected: "1"},
+		{args: []string{"COPY", "b", "c", "REPLACE"}, expected: "1"},
+		{args: []string{"GET", "c"}, expected: "2"},
+		{args: []string{"COPY", "h2", "h3"}, expected: "1"},
+		{args: []string{"HSET", "h3", "f", "changed"}, expected: "0"},
+		{args: []string{"HGET", "h2", "f"}, expected: "v"},
+		{args: []string{"COPY", "missing", "x"}, code: internal.CodeNotFound},
+		{args: []string{"COPY", "b", "b"}, code: internal.CodeSyntax},
+		{args: []string{"COPY", "b", "b", "REPLACE"}, code: internal.CodeSyntax},
+		{args: []string{"COPY", "b", "c", "FORCE"}, code: internal.CodeSyntax},
+		{args: []string{"DBSIZE"}, expected: "4"},
+
+		{args: []string{"SELECT", "other"}, expected: "ok"},
+		{args: []string{"SET", "a", "1"}, expected: "ok"},
+		{args: []string{"FLUSHALL", "a"}, code: internal.CodeSyntax},
+		{args: []string{"FLUSHALL"}, expected: "ok"},
+		{args: []string{"DBSIZE"}, expected: "0"},
+		{args: []string{"SELECT", internal.DefaultNamespace}, expected: "ok"},
+		{args: []string{"DBSIZE"}, expected: "0"},
+		{args: []string{"EXISTS", "b", "c", "h2"}, expected: "0"},
+	})
+}
@@ -1,19 +1,41 @@
 package internal
 
 import (
+	"container/list"
 	"github.com/pkg/errors"
+	"maps"
+	"math"
+	"strconv"
 	"sync"
 )
 
+type ValueType string
+
+const (
+	NoneType   ValueType = "none"
+	StringType ValueType = "string"
+	HashType   ValueType = "hash"
+	ListType   ValueType = "list"
+	SetType    ValueType = "set"
+	ZSetType   ValueType = "zset"
+)
+
+// hashValue значение типа hash: поле -> значение
+type hashValue map[string]string
+
 type InMemoryEngine struct {
-	m   map[string]string
-	mtx sync.RWMutex
+	// m хранит string, hashValue, *list.List, setValue или *zsetValue
+	m map[string]any
+	// keys упорядоченный индекс ключей m для SCAN
+	keys *skipList
+	mtx  sync.RWMutex
 }
 
 func NewInMemoryEngine() *InMemoryEngine {
 	return &InMemoryEngine{
-		m:   make(map[string]string),
-		mtx: sync.RWMutex{},
+		m:    make(map[string]any),
+		keys: newSkipList(),
+		mtx:  sync.RWMutex{},
 	}
 }
 
@@ -26,25 +48,224 @@ func NewEngine(engineType EngineType) (iEngine, error) {
 	}
 }
 
-func (e *InMemoryEngine) Get(key string) (string, bool) {
+func (e *InMemoryEngine) Get(key string) (string, bool, error) {
 	e.mtx.RLock()
 	defer e.mtx.RUnlock()
 
-	val, has := e.m[key]
-
-	return val, has
+	return e.getString(key)
 }
 
 func (e *InMemoryEngine) Set(key string, value string) {
 	e.mtx.Lock()
 	defer e.mtx.Unlock()
 
-	e.m[key] = value
+	e.store(key, value)
 }
 
-func (e *InMemoryEngine) Del(key string) {
+// Del удаляет ключ и возвращает, был ли он
+func (e *InMemoryEngine) Del(key string) bool {
 	e.mtx.Lock()
 	defer e.mtx.Unlock()
 
-	delete(e.m, key)
+	_, has := e.m[key]
+	e.remove(key)
+
+	return has
+}
+
+// Len возвращает количество ключей
+func (e *InMemoryEngine) Len() int {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	return len(e.m)
+}
+
+// Flush удаляет все ключи
+func (e *InMemoryEngine) Flush() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.m = make(map[string]any)
+	e.keys = newSkipList()
+}
+
+// Type возвращает тип значения ключа или NoneType если ключа нет
+func (e *InMemoryEngine) Type(key string) ValueType {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	return valueType(e.m[key])
+}
+
+// MGet возвращает значения ключей, отсутствующие ключи и ключи не строкового типа помечаются false в has
+func (e *InMemoryEngine) MGet(keys []string) (values []string, has []bool) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	values = make([]string, len(keys))
+	has = make([]bool, len(keys))
+	for i, key := range keys {
+		values[i], has[i] = e.m[key].(string)
+	}
+
+	return values, has
+}
+
+// MSet атомарно записывает пары ключ-значение
+func (e *InMemoryEngine) MSet(pairs []string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		e.store(pairs[i], pairs[i+1])
+	}
+}
+
+// MDel удаляет ключи и возвращает количество удаленных
+func (e *InMemoryEngine) MDel(keys []string) int {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	deleted := 0
+	for _, key := range keys {
+		if _, has := e.m[key]; has {
+			e.remove(key)
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+// IncrBy атомарно увеличивает целое значение ключа на delta, отсутствующий ключ считается равным 0
+func (e *InMemoryEngine) IncrBy(key string, delta int64) (int64, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	val, has, err := e.getString(key)
+	if err != nil {
+		return 0, err
+	}
+
+	var current int64
+	if has {
+		current, err = strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return 0, errors.Wrap(ErrNotNumber, "value is not an integer")
+		}
+	}
+
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, errors.Wrap(ErrNotNumber, "increment would overflow")
+	}
+
+	current += delta
+	e.store(key, strconv.FormatInt(current, 10))
+
+	return current, nil
+}
+
+// IncrByFloat атомарно увеличивает значение ключа на delta, отсутствующий ключ считается равным 0
+func (e *InMemoryEngine) IncrByFloat(key string, delta float64) (float64, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	val, has, err := e.getString(key)
+	if err != nil {
+		return 0, err
+	}
+
+	var current float64
+	if has {
+		current, err = strconv.ParseFloat(val, 64)
+		if err != nil {
+			return 0, errors.Wrap(ErrNotNumber, "value is not a float")
+		}
+	}
+
+	current += delta
+	if math.IsInf(current, 0) || math.IsNaN(current) {
+		return 0, errors.Wrap(ErrNotNumber, "increment would produce NaN or Infinity")
+	}
+
+	e.store(key, FormatFloat(current))
+
+	return current, nil
+}
+
+// store записывает значение ключа и добавляет новый ключ в индекс, вызывается под блокировкой
+func (e *InMemoryEngine) store(key string, val any) {
+	if _, has := e.m[key]; !has {
+		e.keys.insert(0, key)
+	}
+	e.m[key] = val
+}
+
+// remove удаляет ключ и его запись в индексе, вызывается под блокировкой
+func (e *InMemoryEngine) remove(key string) {
+	if _, has := e.m[key]; has {
+		e.keys.delete(0, key)
+		delete(e.m, key)
+	}
+}
+
+// getString возвращает строковое значение ключа, вызывается под блокировкой
+func (e *InMemoryEngine) getString(key string) (string, bool, error) {
+	val, has := e.m[key]
+	if !has {
+		return "", false, nil
+	}
+
+	str, ok := val.(string)
+	if !ok {
+		return "", false, ErrWrongType
+	}
+
+	return str, true, nil
+}
+
+// copyValue возвращает независимую копию значения
+func copyValue(val any) any {
+	switch v := val.(type) {
+	case hashValue:
+		return maps.Clone(v)
+	case setValue:
+		return maps.Clone(v)
+	case *list.List:
+		l := list.New()
+		l.PushBackList(v)
+		return l
+	case *zsetValue:
+		zset := newZSetValue()
+		for member, score := range v.scores {
+			zset.scores[member] = score
+			zset.list.insert(score, member)
+		}
+		return zset
+	default:
+		return val
+	}
+}
+
+func valueType(val any) ValueType {
+	switch val.(type) {
+	case string:
+		return StringType
+	case hashValue:
+		return HashType
+	case *list.List:
+		return ListType
+	case setValue:
+		return SetType
+	case *zsetValue:
+		return ZSetType
+	default:
+		return NoneType
+	}
+}
+
+// FormatFloat форматирует число в кратчайшее представление без экспоненты
+func FormatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
 }
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"maps"
+	"slices"
+)
+
+// HSet записывает пары поле-значение в hash и возвращает количество новых полей
+func (e *InMemoryEngine) HSet(key string, pairs []string) (int, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	hash, has, err := e.getHash(key)
+	if err != nil {
+		return 0, err
+	}
+	if !has {
+		hash = make(hashValue, len(pairs)/2)
+		e.store(key, hash)
+	}
+
+	added := 0
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if _, has = hash[pairs[i]]; !has {
+			added++
+		}
+		hash[pairs[i]] = pairs[i+1]
+	}
+
+	return added, nil
+}
+
+func (e *InMemoryEngine) HGet(key string, field string) (string, bool, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	hash, _, err := e.getHash(key)
+	if err != nil {
+		return "", false, err
+	}
+
+	val, has := hash[field]
+
+	return val, has, nil
+}
+
+// HDel удаляет поля из hash и возвращает количество удаленных, пустой hash удаляется
+func (e *InMemoryEngine) HDel(key string, fields []string) (int, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	hash, _, err := e.getHash(key)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, field := range fields {
+		if _, has := hash[field]; has {
+			delete(hash, field)
+			deleted++
+		}
+	}
+
+	if deleted > 0 && len(hash) == 0 {
+		e.remove(key)
+	}
+
+	return deleted, nil
+}
+
+// HGetAll возвращает пары поле-значение отсортированные по полю
+func (e *InMemoryEngine) HGetAll(key string) ([]string, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	hash, _, err := e.getHash(key)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make([]string, 0, len(hash)*2)
+	for _, field := range slices.Sorted(maps.Keys(hash)) {
+		pairs = append(pairs, field, hash[field])
+	}
+
+	return pairs, nil
+}
+
+// HKeys возвращает отсортированные поля hash
+func (e *InMemoryEngine) HKeys(key string) ([]string, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	hash, _, err := e.getHash(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.Sorted(maps.Keys(hash)), nil
+}
+
+// getHash возвращает hash ключа, вызывается под блокировкой
+func (e *InMemoryEngine) getHash(key string) (hashValue, bool, error) {
+	val, has := e.m[key]
+	if !has {
+		return nil, false, nil
+	}
+
+	hash, ok := val.(hashValue)
+	if !ok {
+		return nil, false, ErrWrongType
+	}
+
+	return hash, true, nil
+}
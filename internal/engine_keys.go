@@ -0,0 +1,100 @@
+package internal
+
+// Keys возвращает отсортированные ключи, подходящие под glob шаблон.
+// Обходит все пространство ключей под блокировкой, предназначен для небольших наборов данных
+func (e *InMemoryEngine) Keys(pattern string) []string {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	var keys []string
+	for node := e.keys.head.levels[0].next; node != nil; node = node.levels[0].next {
+		if MatchPattern(pattern, node.member) {
+			keys = append(keys, node.member)
+		}
+	}
+
+	return keys
+}
+
+// Scan просматривает не больше count ключей, следующих за cursor в порядке сортировки,
+// и возвращает подходящие под шаблон. Пустой cursor означает начало, пустой next - конец обхода.
+// Блокировка держится только на время одного шага, ключи существующие на протяжении всего
+// обхода возвращаются ровно один раз
+func (e *InMemoryEngine) Scan(cursor string, pattern string, count int) (next string, keys []string) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	node := e.keys.head.levels[0].next
+	if cursor != "" {
+		node = e.keys.firstAfter(0, cursor)
+	}
+
+	for i := 0; i < count && node != nil; i++ {
+		if MatchPattern(pattern, node.member) {
+			keys = append(keys, node.member)
+		}
+		next = node.member
+		node = node.levels[0].next
+	}
+
+	if node == nil {
+		next = ""
+	}
+
+	return next, keys
+}
+
+// Exists возвращает количество существующих ключей, повторяющиеся ключи считаются повторно
+func (e *InMemoryEngine) Exists(keys []string) int {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	count := 0
+	for _, key := range keys {
+		if _, has := e.m[key]; has {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Rename атомарно переименовывает ключ, существующий dst перезаписывается
+func (e *InMemoryEngine) Rename(src, dst string) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	val, has := e.m[src]
+	if !has {
+		return ErrNotFound
+	}
+
+	if src != dst {
+		e.remove(src)
+		e.remove(dst)
+		e.store(dst, val)
+	}
+
+	return nil
+}
+
+// Copy копирует значение ключа, существующий dst перезаписывается только при replace.
+// Возвращает false если dst существует и replace не задан
+func (e *InMemoryEngine) Copy(src, dst string, replace bool) (bool, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	val, has := e.m[src]
+	if !has {
+		return false, ErrNotFound
+	}
+
+	if _, has = e.m[dst]; has && !replace {
+		return false, nil
+	}
+
+	e.remove(dst)
+	e.store(dst, copyValue(val))
+
+	return true, nil
+}
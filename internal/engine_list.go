@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"container/list"
+)
+
+// LPush добавляет значения в начало списка и возвращает его длину
+func (e *InMemoryEngine) LPush(key string, values []string) (int, error) {
+	return e.push(key, values, (*list.List).PushFront)
+}
+
+// RPush добавляет значения в конец списка и возвращает его длину
+func (e *InMemoryEngine) RPush(key string, values []string) (int, error) {
+	return e.push(key, values, (*list.List).PushBack)
+}
+
+// LPop удаляет и возвращает первый элемент списка, пустой список удаляется
+func (e *InMemoryEngine) LPop(key string) (string, bool, error) {
+	return e.pop(key, (*list.List).Front)
+}
+
+// RPop удаляет и возвращает последний элемент списка, пустой список удаляется
+func (e *InMemoryEngine) RPop(key string) (string, bool, error) {
+	return e.pop(key, (*list.List).Back)
+}
+
+// LRange возвращает элементы с start по stop включительно,
+// отрицательные индексы отсчитываются от конца списка
+func (e *InMemoryEngine) LRange(key string, start, stop int) ([]string, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	l, has, err := e.getList(key)
+	if err != nil || !has {
+		return nil, err
+	}
+
+	length := l.Len()
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	stop = min(stop, length-1)
+	if start > stop {
+		return nil, nil
+	}
+
+	values := make([]string, 0, stop-start+1)
+	i := 0
+	for el := l.Front(); el != nil && i <= stop; el = el.Next() {
+		if i >= start {
+			values = append(values, el.Value.(string))
+		}
+		i++
+	}
+
+	return values, nil
+}
+
+func (e *InMemoryEngine) LLen(key string) (int, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	l, has, err := e.getList(key)
+	if err != nil || !has {
+		return 0, err
+	}
+
+	return l.Len(), nil
+}
+
+func (e *InMemoryEngine) push(key string, values []string, push func(*list.List, any) *list.Element) (int, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	l, has, err := e.getList(key)
+	if err != nil {
+		return 0, err
+	}
+	if !has {
+		l = list.New()
+		e.store(key, l)
+	}
+
+	for _, value := range values {
+		push(l, value)
+	}
+
+	return l.Len(), nil
+}
+
+func (e *InMemoryEngine) pop(key string, elem func(*list.List) *list.Element) (string, bool, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	l, has, err := e.getList(key)
+	if err != nil || !has {
+		return "", false, err
+	}
+
+	value := l.Remove(elem(l)).(string)
+	if l.Len() == 0 {
+		e.remove(key)
+	}
+
+	return value, true, nil
+}
+
+// getList возвращает список ключа, вызывается под блокировкой
+func (e *InMemoryEngine) getList(key string) (*list.List, bool, error) {
+	val, has := e.m[key]
+	if !has {
+		return nil, false, nil
+	}
+
+	l, ok := val.(*list.List)
+	if !ok {
+		return nil, false, ErrWrongType
+	}
+
+	return l, true, nil
+}
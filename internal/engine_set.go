@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"maps"
+	"slices"
+)
+
+// setValue значение типа set
+type setValue map[string]struct{}
+
+// SAdd добавляет элементы в множество и возвращает количество новых
+func (e *InMemoryEngine) SAdd(key string, members []string) (int, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	set, has, err := e.getSet(key)
+	if err != nil {
+		return 0, err
+	}
+	if !has {
+		set = make(setValue, len(members))
+		e.store(key, set)
+	}
+
+	added := 0
+	for _, member := range members {
+		if _, has = set[member]; !has {
+			set[member] = struct{}{}
+			added++
+		}
+	}
+
+	return added, nil
+}
+
+// SRem удаляет элементы из множества и возвращает количество удаленных, пустое множество удаляется
+func (e *InMemoryEngine) SRem(key string, members []string) (int, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	set, _, err := e.getSet(key)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, member := range members {
+		if _, has := set[member]; has {
+			delete(set, member)
+			removed++
+		}
+	}
+
+	if removed > 0 && len(set) == 0 {
+		e.remove(key)
+	}
+
+	return removed, nil
+}
+
+// SMembers возвращает отсортированные элементы множества
+func (e *InMemoryEngine) SMembers(key string) ([]string, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	set, _, err := e.getSet(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.Sorted(maps.Keys(set)), nil
+}
+
+func (e *InMemoryEngine) SIsMember(key string, member string) (bool, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	set, _, err := e.getSet(key)
+	if err != nil {
+		return false, err
+	}
+
+	_, has := set[member]
+
+	return has, nil
+}
+
+// SInter возвращает отсортированное пересечение множеств, отсутствующий ключ считается пустым множеством
+func (e *InMemoryEngine) SInter(keys []string) ([]string, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	sets := make([]setValue, 0, len(keys))
+	for _, key := range keys {
+		set, _, err := e.getSet(key)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+
+	// обходим самое маленькое множество
+	smallest := slices.MinFunc(sets, func(a, b setValue) int {
+		return len(a) - len(b)
+	})
+
+	var members []string
+	for member := range smallest {
+		inAll := true
+		for _, set := range sets {
+			if _, has := set[member]; !has {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			members = append(members, member)
+		}
+	}
+	slices.Sort(members)
+
+	return members, nil
+}
+
+// SUnion возвращает отсортированное объединение множеств
+func (e *InMemoryEngine) SUnion(keys []string) ([]string, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	union := make(setValue)
+	for _, key := range keys {
+		set, _, err := e.getSet(key)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(union, set)
+	}
+
+	return slices.Sorted(maps.Keys(union)), nil
+}
+
+// getSet возвращает множество ключа, вызывается под блокировкой
+func (e *InMemoryEngine) getSet(key string) (setValue, bool, error) {
+	val, has := e.m[key]
+	if !has {
+		return nil, false, nil
+	}
+
+	set, ok := val.(setValue)
+	if !ok {
+		return nil, false, ErrWrongType
+	}
+
+	return set, true, nil
+}
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// maxStringSize предельный размер строкового значения
+const maxStringSize = 512 * 1024 * 1024
+
+var errStringTooLong = errors.Wrap(ErrInvalidCommand, "string exceeds maximum allowed size")
+
+// SetCondition условие записи SET
+type SetCondition string
+
+const (
+	// SetAlways записывает значение без условий
+	SetAlways SetCondition = ""
+	// SetIfNotExists записывает значение только если ключа нет
+	SetIfNotExists SetCondition = "NX"
+	// SetIfExists записывает значение только если ключ есть
+	SetIfExists SetCondition = "XX"
+)
+
+// SetIf записывает значение при выполнении условия и возвращает была ли запись
+func (e *InMemoryEngine) SetIf(key string, value string, cond SetCondition) bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	_, has := e.m[key]
+	if (cond == SetIfNotExists && has) || (cond == SetIfExists && !has) {
+		return false
+	}
+
+	e.store(key, value)
+
+	return true
+}
+
+// Append дописывает value в конец строки и возвращает новую длину, отсутствующий ключ создается
+func (e *InMemoryEngine) Append(key string, value string) (int, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	current, _, err := e.getString(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(current)+len(value) > maxStringSize {
+		return 0, errStringTooLong
+	}
+
+	current += value
+	e.store(key, current)
+
+	return len(current), nil
+}
+
+func (e *InMemoryEngine) StrLen(key string) (int, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	val, _, err := e.getString(key)
+
+	return len(val), err
+}
+
+// GetRange возвращает подстроку с позиции start по end включительно,
+// отрицательные индексы отсчитываются от конца строки
+func (e *InMemoryEngine) GetRange(key string, start, end int) (string, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	val, _, err := e.getString(key)
+	if err != nil {
+		return "", err
+	}
+
+	length := len(val)
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+	if end < 0 {
+		end = length + end
+	}
+	end = min(end, length-1)
+	if start > end {
+		return "", nil
+	}
+
+	return val[start : end+1], nil
+}
+
+// SetRange перезаписывает строку начиная с offset и возвращает новую длину,
+// недостающая часть строки дополняется нулевыми байтами. Пустое значение ключ не меняет
+func (e *InMemoryEngine) SetRange(key string, offset int, value string) (int, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	current, _, err := e.getString(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if value == "" {
+		return len(current), nil
+	}
+
+	if offset > maxStringSize-len(value) {
+		return 0, errStringTooLong
+	}
+
+	if len(current) < offset {
+		current += strings.Repeat("\x00", offset-len(current))
+	}
+
+	var b strings.Builder
+	b.Grow(max(len(current), offset+len(value)))
+	b.WriteString(current[:offset])
+	b.WriteString(value)
+	if end := offset + len(value); end < len(current) {
+		b.WriteString(current[end:])
+	}
+
+	current = b.String()
+	e.store(key, current)
+
+	return len(current), nil
+}
+
+// GetSet записывает значение и возвращает предыдущее
+func (e *InMemoryEngine) GetSet(key string, value string) (string, bool, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	old, has, err := e.getString(key)
+	if err != nil {
+		return "", false, err
+	}
+
+	e.store(key, value)
+
+	return old, has, nil
+}
+
+// GetDel удаляет ключ и возвращает его значение
+func (e *InMemoryEngine) GetDel(key string) (string, bool, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	val, has, err := e.getString(key)
+	if err != nil || !has {
+		return "", false, err
+	}
+
+	e.remove(key)
+
+	return val, true, nil
+}
@@ -0,0 +1,153 @@
+package internal_test
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+
+	"key-value-storage/internal"
+)
+
+func TestInMemoryEngine_ZSet(t *testing.T) {
+	const key = "zset"
+	e := internal.NewInMemoryEngine()
+	model := make(map[string]float64)
+
+	for i := range 2000 {
+		member := "m" + strconv.Itoa(rand.IntN(200))
+		if rand.IntN(3) == 0 {
+			if _, err := e.ZRem(key, []string{member}); err != nil {
+				t.Fatal(err)
+			}
+			delete(model, member)
+		} else {
+			score := float64(rand.IntN(50))
+			if _, err := e.ZAdd(key, []internal.ScoredMember{{Score: score, Member: member}}); err != nil {
+				t.Fatal(err)
+			}
+			model[member] = score
+		}
+
+		if i%100 != 0 {
+			continue
+		}
+
+		expected := make([]internal.ScoredMember, 0, len(model))
+		for member, score := range model {
+			expected = append(expected, internal.ScoredMember{Score: score, Member: member})
+		}
+		slices.SortFunc(expected, func(a, b internal.ScoredMember) int {
+			if c := cmp.Compare(a.Score, b.Score); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.Member, b.Member)
+		})
+
+		got, err := e.ZRange(key, 0, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(expected) == 0 {
+			expected = nil
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("step %d: expected range %v, got %v", i, expected, got)
+		}
+
+		for rank, m := range expected {
+			gotRank, has, err := e.ZRank(key, m.Member)
+			if err != nil || !has || gotRank != rank {
+				t.Fatalf("step %d: expected rank %d for %s, got %d %v %v", i, rank, m.Member, gotRank, has, err)
+			}
+
+			byRank, err := e.ZRange(key, rank, rank)
+			if err != nil || len(byRank) != 1 || byRank[0] != m {
+				t.Fatalf("step %d: expected %v at rank %d, got %v %v", i, m, rank, byRank, err)
+			}
+		}
+
+		byScore, err := e.ZRangeByScore(key, 10, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedByScore := slices.DeleteFunc(slices.Clone(expected), func(m internal.ScoredMember) bool {
+			return m.Score < 10 || m.Score > 20
+		})
+		if len(expectedByScore) == 0 {
+			expectedByScore = nil
+		}
+		if !reflect.DeepEqual(byScore, expectedByScore) {
+			t.Fatalf("step %d: expected by score %v, got %v", i, expectedByScore, byScore)
+		}
+	}
+}
+
+func TestInMemoryEngine_MSetAtomic(t *testing.T) {
+	e := internal.NewInMemoryEngine()
+	keys := []string{"a", "b", "c"}
+	e.MSet([]string{"a", "0", "b", "0", "c", "0"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 1000 {
+			v := strconv.Itoa(i)
+			e.MSet([]string{"a", v, "b", v, "c", v})
+		}
+	}()
+
+	// читатель видит либо все значения одной записи, либо другой
+	for {
+		values, _ := e.MGet(keys)
+		if values[0] != values[1] || values[1] != values[2] {
+			t.Fatalf("partial MSET observed: %v", values)
+		}
+
+		select {
+		case <-done:
+			return
+		default:
+		}
+	}
+}
+
+func TestInMemoryEngine_SetRangeLimit(t *testing.T) {
+	e := internal.NewInMemoryEngine()
+
+	// offset+len(value) не должен переполняться
+	if _, err := e.SetRange("key", math.MaxInt, "a"); !errors.Is(err, internal.ErrInvalidCommand) {
+		t.Fatalf("expected ErrInvalidCommand, got %v", err)
+	}
+	if _, err := e.SetRange("key", 512*1024*1024, "a"); !errors.Is(err, internal.ErrInvalidCommand) {
+		t.Fatalf("expected ErrInvalidCommand, got %v", err)
+	}
+	if _, has, _ := e.Get("key"); has {
+		t.Fatal("expected key to stay absent")
+	}
+}
+
+func TestInMemoryEngine_WrongType(t *testing.T) {
+	e := internal.NewInMemoryEngine()
+	e.Set("str", "value")
+	if _, err := e.SAdd("set", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := e.Get("set"); err != internal.ErrWrongType {
+		t.Fatalf("expected ErrWrongType from Get, got %v", err)
+	}
+	if _, err := e.SAdd("str", []string{"a"}); err != internal.ErrWrongType {
+		t.Fatalf("expected ErrWrongType from SAdd, got %v", err)
+	}
+	if _, err := e.ZAdd("set", []internal.ScoredMember{{Score: 1, Member: "a"}}); err != internal.ErrWrongType {
+		t.Fatalf("expected ErrWrongType from ZAdd, got %v", err)
+	}
+	if got := e.Type("set"); got != internal.SetType {
+		t.Fatalf("expected set type, got %s", got)
+	}
+}
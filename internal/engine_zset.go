@@ -0,0 +1,163 @@
+package internal
+
+// zsetValue значение типа sorted set: индекс member -> score и упорядоченный skip list
+type zsetValue struct {
+	scores map[string]float64
+	list   *skipList
+}
+
+func newZSetValue() *zsetValue {
+	return &zsetValue{
+		scores: make(map[string]float64),
+		list:   newSkipList(),
+	}
+}
+
+// ScoredMember элемент sorted set
+type ScoredMember struct {
+	Score  float64
+	Member string
+}
+
+// ZAdd добавляет элементы или обновляет их score, возвращает количество новых
+func (e *InMemoryEngine) ZAdd(key string, members []ScoredMember) (int, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	zset, has, err := e.getZSet(key)
+	if err != nil {
+		return 0, err
+	}
+	if !has {
+		zset = newZSetValue()
+		e.store(key, zset)
+	}
+
+	added := 0
+	for _, m := range members {
+		score, has := zset.scores[m.Member]
+		if has {
+			if score == m.Score {
+				continue
+			}
+			zset.list.delete(score, m.Member)
+		} else {
+			added++
+		}
+
+		zset.scores[m.Member] = m.Score
+		zset.list.insert(m.Score, m.Member)
+	}
+
+	return added, nil
+}
+
+// ZRem удаляет элементы и возвращает количество удаленных, пустой sorted set удаляется
+func (e *InMemoryEngine) ZRem(key string, members []string) (int, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	zset, has, err := e.getZSet(key)
+	if err != nil || !has {
+		return 0, err
+	}
+
+	removed := 0
+	for _, member := range members {
+		if score, has := zset.scores[member]; has {
+			delete(zset.scores, member)
+			zset.list.delete(score, member)
+			removed++
+		}
+	}
+
+	if removed > 0 && zset.list.length == 0 {
+		e.remove(key)
+	}
+
+	return removed, nil
+}
+
+// ZRange возвращает элементы с позиции start по stop включительно в порядке возрастания score,
+// отрицательные индексы отсчитываются от конца
+func (e *InMemoryEngine) ZRange(key string, start, stop int) ([]ScoredMember, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	zset, has, err := e.getZSet(key)
+	if err != nil || !has {
+		return nil, err
+	}
+
+	length := zset.list.length
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	stop = min(stop, length-1)
+	if start > stop {
+		return nil, nil
+	}
+
+	members := make([]ScoredMember, 0, stop-start+1)
+	node := zset.list.byRank(start)
+	for i := start; i <= stop && node != nil; i++ {
+		members = append(members, ScoredMember{Score: node.score, Member: node.member})
+		node = node.levels[0].next
+	}
+
+	return members, nil
+}
+
+// ZRangeByScore возвращает элементы со score в диапазоне [minScore, maxScore]
+func (e *InMemoryEngine) ZRangeByScore(key string, minScore, maxScore float64) ([]ScoredMember, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	zset, has, err := e.getZSet(key)
+	if err != nil || !has {
+		return nil, err
+	}
+
+	var members []ScoredMember
+	for node := zset.list.firstFrom(minScore); node != nil && node.score <= maxScore; node = node.levels[0].next {
+		members = append(members, ScoredMember{Score: node.score, Member: node.member})
+	}
+
+	return members, nil
+}
+
+// ZRank возвращает позицию элемента начиная с 0
+func (e *InMemoryEngine) ZRank(key string, member string) (int, bool, error) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	zset, has, err := e.getZSet(key)
+	if err != nil || !has {
+		return 0, false, err
+	}
+
+	score, has := zset.scores[member]
+	if !has {
+		return 0, false, nil
+	}
+
+	return zset.list.rank(score, member), true, nil
+}
+
+// getZSet возвращает sorted set ключа, вызывается под блокировкой
+func (e *InMemoryEngine) getZSet(key string) (*zsetValue, bool, error) {
+	val, has := e.m[key]
+	if !has {
+		return nil, false, nil
+	}
+
+	zset, ok := val.(*zsetValue)
+	if !ok {
+		return nil, false, ErrWrongType
+	}
+
+	return zset, true, nil
+}
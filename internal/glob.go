@@ -0,0 +1,86 @@
+package internal
+
+// MatchPattern проверяет соответствие строки glob шаблону:
+// * любая последовательность символов, ? один любой символ,
+// [abc] и [a-z] класс символов, [^abc] отрицание класса
+func MatchPattern(pattern, s string) bool {
+	px, sx := 0, 0
+	// позиции последней * в шаблоне и строки, с которой она начала сопоставление
+	starPx, starSx := -1, 0
+
+	for sx < len(s) {
+		if px < len(pattern) {
+			switch pattern[px] {
+			case '*':
+				starPx, starSx = px, sx
+				px++
+				continue
+			case '?':
+				px++
+				sx++
+				continue
+			case '[':
+				if matched, next, ok := matchClass(pattern, px, s[sx]); ok {
+					if matched {
+						px = next
+						sx++
+						continue
+					}
+				} else if s[sx] == '[' {
+					// незакрытая скобка сравнивается как обычный символ
+					px++
+					sx++
+					continue
+				}
+			default:
+				if pattern[px] == s[sx] {
+					px++
+					sx++
+					continue
+				}
+			}
+		}
+
+		if starPx == -1 {
+			return false
+		}
+
+		// откатываемся к последней * и расширяем ее на один символ
+		starSx++
+		px, sx = starPx+1, starSx
+	}
+
+	for px < len(pattern) && pattern[px] == '*' {
+		px++
+	}
+
+	return px == len(pattern)
+}
+
+// matchClass сопоставляет символ с классом, начинающимся с '[' в позиции start.
+// Возвращает позицию после ']' и ok == false если класс не закрыт
+func matchClass(pattern string, start int, c byte) (matched bool, next int, ok bool) {
+	i := start + 1
+	negate := i < len(pattern) && pattern[i] == '^'
+	if negate {
+		i++
+	}
+
+	for first := true; i < len(pattern); first = false {
+		if pattern[i] == ']' && !first {
+			return matched != negate, i + 1, true
+		}
+
+		lo, hi := pattern[i], pattern[i]
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			i += 2
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+		i++
+	}
+
+	return false, 0, false
+}
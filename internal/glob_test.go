@@ -0,0 +1,39 @@
+package internal_test
+
+import (
+	"testing"
+
+	"key-value-storage/internal"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"*", "", true},
+		{"*", "user/1/name", true},
+		{"user/*", "user/1/name", true},
+		{"user/*/name", "user/1/name", true},
+		{"user/*/name", "user/1/email", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{"*a*b*c", "xxaxxbxxc", true},
+		{"*a*b*c", "xxaxxcxxb", false},
+		{"a[", "a[", true},
+		{"report/*", "reports/1", false},
+	}
+
+	for _, tt := range tests {
+		if got := internal.MatchPattern(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("MatchPattern(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
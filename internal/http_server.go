@@ -0,0 +1,327 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// HTTPConfig HTTP/JSON шлюз, шлюз включается, если задан адрес
+type HTTPConfig struct {
+	Address string `yaml:"address" mapstructure:"address"`
+}
+
+func (c HTTPConfig) Enabled() bool {
+	return c.Address != ""
+}
+
+// httpStatuses сопоставляет коды ошибок со статусами HTTP, остальные ошибки считаются внутренними
+var httpStatuses = map[ErrorCode]int{
+	CodeNotFound:           http.StatusNotFound,
+	CodeSyntax:             http.StatusBadRequest,
+	CodeWrongType:          http.StatusBadRequest,
+	CodeNotNumber:          http.StatusBadRequest,
+	CodeProtocol:           http.StatusBadRequest,
+	CodeTimeout:            http.StatusGatewayTimeout,
+	CodeTooManyConnections: http.StatusServiceUnavailable,
+	CodeTooLarge:           http.StatusRequestEntityTooLarge,
+	CodeNoAuth:             http.StatusUnauthorized,
+	CodeWrongPass:          http.StatusUnauthorized,
+	CodeLocked:             http.StatusTooManyRequests,
+	CodeNoPermission:       http.StatusForbidden,
+	CodeRateLimited:        http.StatusTooManyRequests,
+	CodePushRequired:       http.StatusBadRequest,
+}
+
+// ServerHTTP HTTP/JSON шлюз к базе:
+//
+//	GET    /keys/{key}                      значение ключа
+//	PUT    /keys/{key}  {"value": "..."}    запись значения
+//	DELETE /keys/{key}                      удаление ключа
+//	POST   /query       {"query": "..."} или {"args": ["...", ...]} произвольная команда
+//
+// Успешный ответ {"result": ...}, ошибка {"code": "...", "error": "..."}.
+// Пользователь передается через Basic auth или сертификат клиента,
+// пространство ключей параметром ?namespace=, так как сессия живет один запрос и SELECT не работает
+type ServerHTTP struct {
+	cfg    NetworkConfig
+	db     iServerDB
+	logger zerolog.Logger
+
+	// userLimits ограничения частоты запросов пользователей, соединений у шлюза нет
+	userLimits *UserRateLimits
+	stats      *ServerCounters
+}
+
+// httpBodyOverhead запас на экранирование JSON сверх MaxMessageSize
+const httpBodyOverhead = 2
+
+// httpNamespaceParam параметр запроса с пространством ключей
+const httpNamespaceParam = "namespace"
+
+// httpReadHeaderTimeout ограничивает время чтения заголовков медленными клиентами
+const httpReadHeaderTimeout = 10 * time.Second
+
+type httpValue struct {
+	Value *string `json:"value"`
+}
+
+type httpQuery struct {
+	Query string   `json:"query"`
+	Args  []string `json:"args"`
+}
+
+type httpResult struct {
+	Result any `json:"result"`
+}
+
+type httpError struct {
+	Code  ErrorCode `json:"code"`
+	Error string    `json:"error"`
+}
+
+func NewServerHTTP(config NetworkConfig, db iServerDB, logger zerolog.Logger, opts ...ServerOption) *ServerHTTP {
+	options := newServerOptions(config.RateLimit, opts)
+	return &ServerHTTP{cfg: config, db: db, logger: logger, userLimits: options.userLimits, stats: options.stats}
+}
+
+// Run обслуживает запросы до отмены ctx, затем ждет завершения запросов в пределах DrainTimeout
+func (h *ServerHTTP) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", h.cfg.HTTP.Address)
+	if err != nil {
+		return err
+	}
+
+	if h.cfg.TLS.Enabled() {
+		tlsConfig, err := NewServerTLSConfig(h.cfg.TLS)
+		if err != nil {
+			_ = listener.Close()
+			return errors.Wrap(err, "failed to configure tls")
+		}
+
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	server := &http.Server{
+		Handler:           h.Handler(),
+		IdleTimeout:       h.cfg.IdleTimeout,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		// запросы не должны прерываться сразу при остановке, их дожидается Shutdown
+		BaseContext: func(net.Listener) context.Context { return context.WithoutCancel(ctx) },
+	}
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+
+		drainCtx, cancel := context.WithTimeout(context.Background(), h.cfg.DrainTimeout)
+		defer cancel()
+		shutdownErr <- server.Shutdown(drainCtx)
+	}()
+
+	h.logger.Info().Msg("listening on http://" + h.cfg.HTTP.Address)
+	if err = server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	if err = <-shutdownErr; err != nil {
+		_ = server.Close()
+		return errors.Wrap(err, "failed to drain http requests")
+	}
+	h.logger.Info().Msg("http listener closed")
+
+	return nil
+}
+
+// Handler возвращает обработчик запросов шлюза
+func (h *ServerHTTP) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /keys/{key}", func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, []string{string(Get), r.PathValue("key")})
+	})
+	mux.HandleFunc("PUT /keys/{key}", func(w http.ResponseWriter, r *http.Request) {
+		var body httpValue
+		if !h.decode(w, r, &body) {
+			return
+		}
+		if body.Value == nil {
+			h.writeError(w, errors.Wrap(ErrInvalidCommand, "value is required"))
+			return
+		}
+
+		h.serve(w, r, []string{string(Set), r.PathValue("key"), *body.Value})
+	})
+	mux.HandleFunc("DELETE /keys/{key}", func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, []string{string(Del), r.PathValue("key")})
+	})
+	mux.HandleFunc("POST /query", func(w http.ResponseWriter, r *http.Request) {
+		var body httpQuery
+		if !h.decode(w, r, &body) {
+			return
+		}
+
+		args := body.Args
+		if len(args) == 0 {
+			args = strings.Fields(body.Query)
+		}
+		if len(args) == 0 {
+			h.writeError(w, errors.Wrap(ErrInvalidCommand, "query is required"))
+			return
+		}
+
+		h.serve(w, r, args)
+	})
+
+	return mux
+}
+
+// serve выполняет команду от имени пользователя запроса
+func (h *ServerHTTP) serve(w http.ResponseWriter, r *http.Request, args []string) {
+	// те же ограничения размера, что у запроса текстового протокола
+	size := len(strings.Join(args, " "))
+	if h.cfg.MaxMessageSize > 0 && size > h.cfg.MaxMessageSize {
+		h.writeError(w, errors.Wrapf(ErrMessageTooLarge, "message exceeds %d bytes", h.cfg.MaxMessageSize))
+		return
+	}
+
+	if strings.EqualFold(args[0], string(Select)) {
+		h.writeError(w, errors.Wrapf(ErrInvalidCommand, "use the %s parameter instead of SELECT", httpNamespaceParam))
+		return
+	}
+
+	session := NewSession()
+	session.Addr = r.RemoteAddr
+	ctx := ContextWithSession(r.Context(), session)
+
+	if r.TLS != nil {
+		if user := certificateIdentity(*r.TLS); user != "" {
+			session.SetUser(user)
+		}
+	}
+
+	if user, password, ok := r.BasicAuth(); ok {
+		if _, err := h.db.QueryArgs(ctx, []string{string(Auth), user, password}); err != nil {
+			h.writeError(w, err)
+			return
+		}
+	}
+
+	if namespace := r.URL.Query().Get(httpNamespaceParam); namespace != "" {
+		if _, err := h.db.QueryArgs(ctx, []string{string(Select), namespace}); err != nil {
+			h.writeError(w, err)
+			return
+		}
+	}
+
+	if err := h.limit(ctx, size); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.logger.Debug().Msgf("%s %s %s: %v", r.RemoteAddr, r.Method, r.URL.Path, redactArgs(args))
+	h.stats.queries.Add(1)
+	reply, err := h.db.QueryArgs(ctx, args)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, httpResult{Result: replyValue(reply)})
+}
+
+// limit применяет ограничения пользователя запроса, при действии delay ждет накопления токенов
+func (h *ServerHTTP) limit(ctx context.Context, size int) error {
+	wait, err := newUserRateLimiter(h.cfg.RateLimit, h.userLimits).take(SessionFromContext(ctx).User(), size)
+	if err != nil {
+		h.stats.rateLimited.Add(1)
+		return err
+	}
+	if wait == 0 {
+		return nil
+	}
+
+	h.stats.delayed.Add(1)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// decode читает тело запроса, ограничивая его размер
+func (h *ServerHTTP) decode(w http.ResponseWriter, r *http.Request, body any) bool {
+	if h.cfg.MaxMessageSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(h.cfg.MaxMessageSize*httpBodyOverhead))
+	}
+
+	err := json.NewDecoder(r.Body).Decode(body)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		h.writeError(w, errors.Wrapf(ErrMessageTooLarge, "body exceeds %d bytes", maxBytesErr.Limit))
+		return false
+	}
+	if err != nil {
+		h.writeError(w, errors.Wrap(ErrInvalidCommand, "invalid json body: "+err.Error()))
+		return false
+	}
+
+	return true
+}
+
+func (h *ServerHTTP) writeError(w http.ResponseWriter, err error) {
+	code := ErrorCodeOf(err)
+	status, has := httpStatuses[code]
+	if !has {
+		status = http.StatusInternalServerError
+		h.logger.Error().Err(err).Msg("http query failed")
+	}
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="key-value-storage"`)
+	}
+
+	h.writeJSON(w, status, httpError{Code: code, Error: err.Error()})
+}
+
+func (h *ServerHTTP) writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.logger.Error().Err(err).Msg("error writing http response")
+	}
+}
+
+// replyValue переводит ответ в значение JSON: MapReply становится объектом, NilReply null
+func replyValue(reply Reply) any {
+	switch reply.Type {
+	case IntReply:
+		return reply.Int
+	case NilReply:
+		return nil
+	case ArrayReply:
+		items := make([]any, len(reply.Array))
+		for i, item := range reply.Array {
+			items[i] = replyValue(item)
+		}
+		return items
+	case MapReply:
+		pairs := make(map[string]any, len(reply.Array)/2)
+		for i := 0; i+1 < len(reply.Array); i += 2 {
+			pairs[reply.Array[i].Str] = replyValue(reply.Array[i+1])
+		}
+		return pairs
+	default:
+		return reply.Str
+	}
+}
@@ -0,0 +1,186 @@
+package internal_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+	"key-value-storage/internal/client"
+)
+
+func TestServerHTTP(t *testing.T) {
+	hash, err := internal.HashPassword("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := internal.NewAuthenticator(internal.AuthConfig{
+		Users: []internal.UserConfig{{Name: "app", Password: hash}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.Nop()
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := internal.NewDB(internal.NewParser(logger), storage, logger, internal.WithAuth(auth))
+	server := httptest.NewServer(internal.NewServerHTTP(internal.NetworkConfig{MaxMessageSize: 32}, db, logger).Handler())
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		noAuth   bool
+		status   int
+		response string
+	}{
+		{name: "no auth", method: http.MethodGet, path: "/keys/a", noAuth: true, status: http.StatusUnauthorized},
+		{name: "not found", method: http.MethodGet, path: "/keys/a", status: http.StatusNotFound},
+		{name: "put", method: http.MethodPut, path: "/keys/a", body: `{"value": "hello world"}`, status: http.StatusOK},
+		{name: "get", method: http.MethodGet, path: "/keys/a", status: http.StatusOK, response: `{"result":"hello world"}`},
+		{name: "put without value", method: http.MethodPut, path: "/keys/a", body: `{}`, status: http.StatusBadRequest},
+		{name: "put too large", method: http.MethodPut, path: "/keys/a", body: `{"value": "` + strings.Repeat("x", 40) + `"}`,
+			status: http.StatusRequestEntityTooLarge},
+		{name: "query", method: http.MethodPost, path: "/query", body: `{"args": ["HSET", "h", "f", "v"]}`, status: http.StatusOK},
+		{name: "query map", method: http.MethodPost, path: "/query", body: `{"query": "HGETALL h"}`,
+			status: http.StatusOK, response: `{"result":{"f":"v"}}`},
+		{name: "invalid command", method: http.MethodPost, path: "/query", body: `{"query": "NOPE a"}`, status: http.StatusBadRequest},
+		{name: "delete", method: http.MethodDelete, path: "/keys/a", status: http.StatusOK},
+		{name: "deleted", method: http.MethodGet, path: "/keys/a", status: http.StatusNotFound},
+		{name: "subscribe", method: http.MethodPost, path: "/query", body: `{"query": "SUBSCRIBE news"}`, status: http.StatusBadRequest},
+		{name: "select", method: http.MethodPost, path: "/query", body: `{"query": "SELECT other"}`, status: http.StatusBadRequest},
+		{name: "put namespace", method: http.MethodPut, path: "/keys/a?namespace=other", body: `{"value": "x"}`, status: http.StatusOK},
+		{name: "get namespace", method: http.MethodGet, path: "/keys/a?namespace=other", status: http.StatusOK, response: `{"result":"x"}`},
+		{name: "other namespace", method: http.MethodGet, path: "/keys/a", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.noAuth {
+				req.SetBasicAuth("app", "s3cret")
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+			if tt.response != "" {
+				body, err := io.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := strings.TrimSpace(string(body)); got != tt.response {
+					t.Errorf("expected response %s, got %s", tt.response, got)
+				}
+			}
+		})
+	}
+}
+
+func TestServerHTTP_RateLimit(t *testing.T) {
+	hash, err := internal.HashPassword("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := internal.NewAuthenticator(internal.AuthConfig{
+		Users: []internal.UserConfig{{Name: "app", Password: hash}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.Nop()
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := internal.NewServerCounters()
+	db := internal.NewDB(internal.NewParser(logger), storage, logger, internal.WithAuth(auth), internal.WithServerStats(stats))
+
+	cfg := internal.NetworkConfig{
+		Address:        freeAddress(t),
+		MaxConnections: 10,
+		IdleTimeout:    time.Minute,
+		RateLimit:      internal.RateLimitConfig{UserQPS: 3, Action: internal.RateLimitReject},
+	}
+	opts := []internal.ServerOption{
+		internal.WithUserRateLimits(internal.NewUserRateLimits(cfg.RateLimit)),
+		internal.WithServerCounters(stats),
+	}
+	tcpServer := internal.NewServerTCP(cfg, db, logger, opts...)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = tcpServer.Run(ctx) }()
+	time.Sleep(100 * time.Millisecond)
+
+	httpServer := httptest.NewServer(internal.NewServerHTTP(cfg, db, logger, opts...).Handler())
+	defer httpServer.Close()
+
+	get := func() int {
+		req, err := http.NewRequest(http.MethodGet, httpServer.URL+"/keys/a", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth("app", "s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	if status := get(); status != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, status)
+	}
+
+	// пользователь тратит остаток ограничения через TCP, следующий HTTP запрос отклоняется
+	c, cl, err := client.NewClientTCP(cfg.Address.String(), logger, time.Second, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl()
+	if _, err = c.Query(context.Background(), "AUTH app s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if _, err = c.Query(context.Background(), "PING"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if status := get(); status != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, status)
+	}
+
+	// отказ шлюза учитывается в общих счетчиках, которые видны в INFO
+	info, err := db.QueryArgs(context.Background(), []string{"INFO"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"connections=1", "queries=4", "rate_limited=1"} {
+		if !strings.Contains(info.String()+" ", field+" ") {
+			t.Errorf("expected %s in INFO %q", field, info.String())
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Классы событий изменения ключей
+const (
+	// EventsGeneric удаление, переименование, копирование и очистка ключей
+	EventsGeneric = "generic"
+	EventsString  = "string"
+	EventsHash    = "hash"
+	EventsList    = "list"
+	EventsSet     = "set"
+	EventsZSet    = "zset"
+	// EventsAll все классы событий
+	EventsAll = "all"
+)
+
+// Каналы событий: в KeyspaceChannel+<ключ> публикуется имя события,
+// в KeyeventChannel+<событие> имя ключа
+const (
+	KeyspaceChannel = "__keyspace__/"
+	KeyeventChannel = "__keyevent__/"
+)
+
+// channelKeys возвращает ключи, о которых сообщают каналы уведомлений.
+// false означает, что подписка получит имена любых ключей: KeyeventChannel
+// или шаблон, под который попадают каналы уведомлений
+func channelKeys(channels []string, patterns bool) ([]string, bool) {
+	var keys []string
+	for _, channel := range channels {
+		if i := strings.IndexAny(channel, `*?[\`); patterns && i >= 0 {
+			prefix := channel[:i]
+			for _, notifications := range []string{KeyspaceChannel, KeyeventChannel} {
+				if strings.HasPrefix(notifications, prefix) || strings.HasPrefix(prefix, notifications) {
+					return nil, false
+				}
+			}
+			continue
+		}
+
+		if strings.HasPrefix(channel, KeyeventChannel) {
+			return nil, false
+		}
+		if key, has := strings.CutPrefix(channel, KeyspaceChannel); has {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, true
+}
+
+// NotificationsConfig настройки уведомлений об изменении ключей
+type NotificationsConfig struct {
+	// Events классы событий, пустой список выключает уведомления
+	Events []string `yaml:"events" mapstructure:"events"`
+}
+
+// eventClasses сопоставляет записи журнала с классом и именем события
+var eventClasses = map[CommandType]struct{ class, event string }{
+	Set:      {EventsString, "set"},
+	MSet:     {EventsString, "set"},
+	Append:   {EventsString, "append"},
+	SetRange: {EventsString, "setrange"},
+	Del:      {EventsGeneric, "del"},
+	MDel:     {EventsGeneric, "del"},
+	Rename:   {EventsGeneric, "rename"},
+	Copy:     {EventsGeneric, "copy"},
+	FlushDB:  {EventsGeneric, "flushdb"},
+	FlushAll: {EventsGeneric, "flushall"},
+	HSet:     {EventsHash, "hset"},
+	HDel:     {EventsHash, "hdel"},
+	LPush:    {EventsList, "lpush"},
+	RPush:    {EventsList, "rpush"},
+	LPop:     {EventsList, "lpop"},
+	RPop:     {EventsList, "rpop"},
+	SAdd:     {EventsSet, "sadd"},
+	SRem:     {EventsSet, "srem"},
+	ZAdd:     {EventsZSet, "zadd"},
+	ZRem:     {EventsZSet, "zrem"},
+}
+
+// KeyspaceEvents публикует изменения ключей выбранных классов
+type KeyspaceEvents struct {
+	broker  *Broker
+	classes map[string]struct{}
+}
+
+// NewKeyspaceEvents возвращает nil, если уведомления выключены:
+// тогда хранилище не тратит время на события
+func NewKeyspaceEvents(cfg NotificationsConfig, broker *Broker) (*KeyspaceEvents, error) {
+	if len(cfg.Events) == 0 {
+		return nil, nil
+	}
+	if broker == nil {
+		return nil, errors.New("keyspace notifications require pub/sub")
+	}
+
+	classes := make(map[string]struct{})
+	for _, class := range cfg.Events {
+		switch class {
+		case EventsAll:
+			for _, c := range []string{EventsGeneric, EventsString, EventsHash, EventsList, EventsSet, EventsZSet} {
+				classes[c] = struct{}{}
+			}
+		case EventsGeneric, EventsString, EventsHash, EventsList, EventsSet, EventsZSet:
+			classes[class] = struct{}{}
+		default:
+			return nil, errors.Errorf("unknown event class %s", class)
+		}
+	}
+
+	return &KeyspaceEvents{broker: broker, classes: classes}, nil
+}
+
+// publish публикует события по записи журнала, команды без ключей сообщают пространство ключей.
+// События получают только подписчики из пространства ключей записи, FLUSHALL получают все
+func (e *KeyspaceEvents) publish(record Command) {
+	event, has := eventClasses[record.Type]
+	if !has {
+		return
+	}
+	if _, enabled := e.classes[event.class]; !enabled {
+		return
+	}
+
+	if record.Type == FlushAll {
+		e.broker.Publish(KeyeventChannel+event.event, record.Namespace)
+		return
+	}
+
+	keys, ok := record.keyArgs()
+	if !ok {
+		e.broker.publishIn(record.Namespace, KeyeventChannel+event.event, record.Namespace)
+		return
+	}
+
+	// COPY меняет только ключ назначения
+	if record.Type == Copy {
+		keys = keys[1:]
+	}
+
+	for _, key := range keys {
+		e.broker.publishIn(record.Namespace, KeyspaceChannel+key, event.event)
+		e.broker.publishIn(record.Namespace, KeyeventChannel+event.event, key)
+	}
+}
@@ -0,0 +1,113 @@
+package internal_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+)
+
+func TestKeyspaceEvents(t *testing.T) {
+	logger := zerolog.Nop()
+	broker, err := internal.NewBroker(internal.PubSubConfig{BufferSize: 16, SlowConsumer: internal.SlowConsumerDrop}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := internal.NewKeyspaceEvents(internal.NotificationsConfig{}, broker)
+	if err != nil || events != nil {
+		t.Fatalf("expected notifications to be disabled, got %v %v", events, err)
+	}
+
+	events, err = internal.NewKeyspaceEvents(internal.NotificationsConfig{Events: []string{internal.EventsGeneric}}, broker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, events, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subscriber := broker.NewSubscriber()
+	defer subscriber.Close()
+	subscriber.Subscribe(internal.KeyspaceChannel+"a", internal.KeyeventChannel+"del")
+
+	ctx := context.Background()
+	// класс string выключен, поэтому SET не публикуется
+	if err = storage.Set(ctx, "a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = storage.Del(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []internal.Message{
+		{Channel: internal.KeyspaceChannel + "a", Payload: "del"},
+		{Channel: internal.KeyeventChannel + "del", Payload: "a"},
+	}
+	for _, w := range want {
+		select {
+		case m := <-subscriber.Messages():
+			if m != w {
+				t.Errorf("expected %+v, got %+v", w, m)
+			}
+		default:
+			t.Fatalf("expected %+v, got nothing", w)
+		}
+	}
+	if len(subscriber.Messages()) != 0 {
+		t.Errorf("unexpected message %+v", <-subscriber.Messages())
+	}
+}
+
+func TestKeyspaceEvents_Namespaces(t *testing.T) {
+	logger := zerolog.Nop()
+	broker, err := internal.NewBroker(internal.PubSubConfig{BufferSize: 16, SlowConsumer: internal.SlowConsumerDrop}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := internal.NewKeyspaceEvents(internal.NotificationsConfig{Events: []string{internal.EventsAll}}, broker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, events, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := internal.NewDB(internal.NewParser(logger), storage, logger, internal.WithBroker(broker))
+
+	listener := internal.NewSession()
+	listener.AllowPush()
+	listenerCtx := internal.ContextWithSession(context.Background(), listener)
+	if _, err = db.QueryArgs(listenerCtx, []string{"SELECT", "cache"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.QueryArgs(listenerCtx, []string{"SUBSCRIBE", internal.KeyspaceChannel + "k"}); err != nil {
+		t.Fatal(err)
+	}
+
+	writerCtx := internal.ContextWithSession(context.Background(), internal.NewSession())
+	for _, args := range [][]string{
+		{"SET", "k", "default"},
+		{"SELECT", "other"},
+		{"SET", "k", "other"},
+		{"SELECT", "cache"},
+		{"SET", "k", "cache"},
+	} {
+		if _, err = db.QueryArgs(writerCtx, args); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// событие получает только подписчик из того же пространства ключей
+	messages := listener.Subscriber().Messages()
+	want := internal.Message{Channel: internal.KeyspaceChannel + "k", Payload: "set"}
+	if m := <-messages; m != want {
+		t.Errorf("expected %+v, got %+v", want, m)
+	}
+	if len(messages) != 0 {
+		t.Errorf("unexpected message %+v", <-messages)
+	}
+}
@@ -0,0 +1,42 @@
+package internal
+
+import "sync"
+
+// keyNotifier будит горутины, ожидающие изменения ключа
+type keyNotifier struct {
+	mtx   sync.Mutex
+	chans map[string]chan struct{}
+}
+
+func newKeyNotifier() *keyNotifier {
+	return &keyNotifier{
+		mtx:   sync.Mutex{},
+		chans: make(map[string]chan struct{}),
+	}
+}
+
+// wait возвращает канал, который закроется при следующем notify по ключу.
+// Подписываться нужно до проверки состояния, чтобы не пропустить уведомление
+func (n *keyNotifier) wait(key string) <-chan struct{} {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	ch, has := n.chans[key]
+	if !has {
+		ch = make(chan struct{})
+		n.chans[key] = ch
+	}
+
+	return ch
+}
+
+// notify будит всех ожидающих ключ
+func (n *keyNotifier) notify(key string) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if ch, has := n.chans[key]; has {
+		close(ch)
+		delete(n.chans, key)
+	}
+}
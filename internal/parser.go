@@ -8,14 +8,82 @@ import (
 	"unicode/utf8"
 )
 
-// query = set_command | get_command | del_command
+// query = set_command | get_command | del_command | mset_command | mget_command | mdel_command |
+//	incr_command | decr_command | incrby_command | incrbyfloat_command | type_command |
+//	hset_command | hget_command | hdel_command | hgetall_command | hkeys_command |
+//	lpush_command | rpush_command | lpop_command | rpop_command | lrange_command | llen_command | blpop_command |
+//	sadd_command | srem_command | smembers_command | sismember_command | sinter_command | sunion_command |
+//	zadd_command | zrange_command | zrangebyscore_command | zrank_command | zrem_command |
+//	keys_command | scan_command | select_command | flushdb_command | info_command |
+//	exists_command | rename_command | copy_command | dbsize_command | flushall_command |
+//	append_command | strlen_command | getrange_command | setrange_command | getset_command | getdel_command |
+//	setnx_command | ping_command | auth_command | acl_command |
+//	publish_command | subscribe_command | psubscribe_command | unsubscribe_command | punsubscribe_command |
+//	slowlog_command
 //
-//set_command = "SET" argument argument
-//get_command = "GET" argument
-//del_command = "DEL" argument
+//set_command  = "SET" argument argument [ "NX" | "XX" ]
+//get_command  = "GET" argument
+//del_command  = "DEL" argument
+//mset_command = "MSET" argument argument { argument argument }
+//mget_command = "MGET" argument { argument }
+//mdel_command = "MDEL" argument { argument }
+//incr_command = "INCR" argument
+//decr_command = "DECR" argument
+//incrby_command      = "INCRBY" argument argument
+//incrbyfloat_command = "INCRBYFLOAT" argument argument
+//type_command    = "TYPE" argument
+//hset_command    = "HSET" argument argument argument { argument argument }
+//hget_command    = "HGET" argument argument
+//hdel_command    = "HDEL" argument argument { argument }
+//hgetall_command = "HGETALL" argument
+//hkeys_command   = "HKEYS" argument
+//lpush_command  = "LPUSH" argument argument { argument }
+//rpush_command  = "RPUSH" argument argument { argument }
+//lpop_command   = "LPOP" argument
+//rpop_command   = "RPOP" argument
+//lrange_command = "LRANGE" argument argument argument
+//llen_command   = "LLEN" argument
+//blpop_command  = "BLPOP" argument argument
+//sadd_command      = "SADD" argument argument { argument }
+//srem_command      = "SREM" argument argument { argument }
+//smembers_command  = "SMEMBERS" argument
+//sismember_command = "SISMEMBER" argument argument
+//sinter_command    = "SINTER" argument { argument }
+//sunion_command    = "SUNION" argument { argument }
+//zadd_command          = "ZADD" argument argument argument { argument argument }
+//zrange_command        = "ZRANGE" argument argument argument
+//zrangebyscore_command = "ZRANGEBYSCORE" argument argument argument
+//zrank_command         = "ZRANK" argument argument
+//zrem_command          = "ZREM" argument argument { argument }
+//keys_command = "KEYS" argument
+//scan_command = "SCAN" argument [ "MATCH" argument ] [ "COUNT" argument ]
+//select_command  = "SELECT" argument
+//flushdb_command = "FLUSHDB"
+//info_command    = "INFO"
+//exists_command   = "EXISTS" argument { argument }
+//rename_command   = "RENAME" argument argument
+//copy_command     = "COPY" argument argument [ "REPLACE" ]
+//dbsize_command   = "DBSIZE"
+//flushall_command = "FLUSHALL"
+//append_command   = "APPEND" argument argument
+//strlen_command   = "STRLEN" argument
+//getrange_command = "GETRANGE" argument argument argument
+//setrange_command = "SETRANGE" argument argument argument
+//getset_command   = "GETSET" argument argument
+//getdel_command   = "GETDEL" argument
+//setnx_command    = "SETNX" argument argument
+//ping_command     = "PING"
+//auth_command     = "AUTH" [ argument ] argument
+//acl_command      = "ACL" ( "WHOAMI" | "LIST" )
+//publish_command      = "PUBLISH" argument argument
+//subscribe_command    = "SUBSCRIBE" argument { argument }
+//psubscribe_command   = "PSUBSCRIBE" argument { argument }
+//unsubscribe_command  = "UNSUBSCRIBE" { argument }
+//punsubscribe_command = "PUNSUBSCRIBE" { argument }
+//slowlog_command      = "SLOWLOG" ( "GET" [ digit { digit } ] | "LEN" | "RESET" )
 //argument    = punctuation | letter | digit { punctuation | letter | digit }
 //
-//punctuation = "*" | "/" | "_" | ...
+//punctuation = "*" | "/" | "_" | "-" | "." | "?" | "[" | "]" | "^" | ...
 //letter      = "a" | ... | "z" | "A" | ... | "Z"
 //digit       = "0" | ... | "9"
 //
@@ -31,7 +99,7 @@ func NewParser(logger zerolog.Logger) Parser {
 }
 
 func (p Parser) Parse(line string) (Command, error) {
-	p.logger.Debug().Msgf("parsing '%s'", line)
+	p.logger.Debug().Msgf("parsing '%s'", redactQuery(line))
 	tokens := strings.Split(line, " ")
 	for i, param := range tokens {
 		invalidCharIndex := strings.IndexFunc(param, func(r rune) bool {
@@ -53,11 +121,37 @@ func (p Parser) Parse(line string) (Command, error) {
 		return Command{}, errors.Wrapf(ErrInvalidCommand, "invalid command len %d", len(tokens))
 	}
 
-	p.logger.Debug().Msgf("tokens: %v", tokens)
+	p.logger.Debug().Msgf("tokens: %v", redactArgs(tokens))
 
+	return p.parseTokens(tokens)
+}
+
+// ParseArgs разбирает команду, уже разделенную на аргументы (RESP).
+// Аргументы передаются как есть, поэтому набор символов не ограничивается,
+// имя команды не зависит от регистра
+func (p Parser) ParseArgs(args []string) (Command, error) {
+	if len(args) == 0 {
+		return Command{}, errors.Wrapf(ErrInvalidCommand, "invalid command len %d", len(args))
+	}
+
+	tokens := slices.Clone(args)
+	tokens[0] = strings.ToUpper(tokens[0])
+
+	return p.parseTokens(tokens)
+}
+
+func (p Parser) parseTokens(tokens []string) (Command, error) {
 	commandType := CommandType(tokens[0])
 	switch commandType {
-	case Get, Set, Del:
+	case Get, Set, Del, MGet, MSet, MDel, Incr, Decr, IncrBy, IncrByFloat, Type,
+		HSet, HGet, HDel, HGetAll, HKeys,
+		LPush, RPush, LPop, RPop, LRange, LLen, BLPop,
+		SAdd, SRem, SMembers, SIsMember, SInter, SUnion,
+		ZAdd, ZRange, ZRangeByScore, ZRank, ZRem,
+		Keys, Scan, Select, FlushDB, Info,
+		Exists, Rename, Copy, DBSize, FlushAll,
+		Append, StrLen, GetRange, SetRange, GetSet, GetDel, SetNX, Ping, Auth, ACL,
+		Publish, Subscribe, PSubscribe, Unsubscribe, PUnsubscribe, SlowLog:
 	default:
 		return Command{}, errors.Wrapf(ErrInvalidCommand, "invalid command type %s", tokens[0])
 	}
@@ -86,7 +180,12 @@ func isValidChar(char rune) bool {
 		return true
 	}
 
-	if char == '*' || char == '_' || char == '/' {
+	if char == '*' || char == '_' || char == '/' || char == '-' || char == '.' {
+		return true
+	}
+
+	// символы glob шаблонов KEYS и SCAN
+	if char == '?' || char == '[' || char == ']' || char == '^' {
 		return true
 	}
 
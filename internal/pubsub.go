@@ -0,0 +1,343 @@
+package internal
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Политики для подписчиков, которые не успевают забирать сообщения
+const (
+	// SlowConsumerDrop отбрасывает сообщения, не поместившиеся в буфер подписчика
+	SlowConsumerDrop = "drop"
+	// SlowConsumerDisconnect отключает подписчика при переполнении буфера
+	SlowConsumerDisconnect = "disconnect"
+)
+
+// Виды сообщений push-режима
+const (
+	pushSubscribe    = "subscribe"
+	pushPSubscribe   = "psubscribe"
+	pushUnsubscribe  = "unsubscribe"
+	pushPUnsubscribe = "punsubscribe"
+	pushMessage      = "message"
+	pushPMessage     = "pmessage"
+)
+
+var ErrPushRequired = errors.New("subscriptions require a connection in push mode")
+
+// PubSubConfig настройки рассылки сообщений
+type PubSubConfig struct {
+	// BufferSize число сообщений, ожидающих отправки одному подписчику
+	BufferSize int `yaml:"buffer_size" mapstructure:"buffer_size"`
+	// SlowConsumer политика при переполнении буфера: drop или disconnect
+	SlowConsumer string `yaml:"slow_consumer" mapstructure:"slow_consumer"`
+}
+
+// Message сообщение канала, Pattern задан, если подписка была по шаблону
+type Message struct {
+	Pattern string
+	Channel string
+	Payload string
+}
+
+// Broker рассылает сообщения подписчикам каналов и шаблонов каналов
+type Broker struct {
+	mtx      sync.RWMutex
+	channels map[string]map[*Subscriber]struct{}
+	patterns map[string]map[*Subscriber]struct{}
+
+	bufferSize int
+	disconnect bool
+	logger     zerolog.Logger
+}
+
+func NewBroker(cfg PubSubConfig, logger zerolog.Logger) (*Broker, error) {
+	if cfg.BufferSize <= 0 {
+		return nil, errors.Errorf("invalid subscriber buffer size %d", cfg.BufferSize)
+	}
+	if cfg.SlowConsumer != SlowConsumerDrop && cfg.SlowConsumer != SlowConsumerDisconnect {
+		return nil, errors.Errorf("unknown slow consumer policy %s", cfg.SlowConsumer)
+	}
+
+	return &Broker{
+		channels:   make(map[string]map[*Subscriber]struct{}),
+		patterns:   make(map[string]map[*Subscriber]struct{}),
+		bufferSize: cfg.BufferSize,
+		disconnect: cfg.SlowConsumer == SlowConsumerDisconnect,
+		logger:     logger,
+	}, nil
+}
+
+// Publish отправляет сообщение подписчикам канала и подходящих шаблонов,
+// возвращает число подписок, получивших сообщение
+func (b *Broker) Publish(channel, payload string) int {
+	return b.publish(channel, payload, nil)
+}
+
+// publishIn отправляет сообщение только подписчикам, подписавшимся из пространства ключей namespace
+func (b *Broker) publishIn(namespace, channel, payload string) int {
+	return b.publish(channel, payload, func(s *Subscriber) bool {
+		return s.Namespace() == namespace
+	})
+}
+
+// publish рассылает сообщение подписчикам, для которых accept вернул true, nil принимает всех
+func (b *Broker) publish(channel, payload string, accept func(s *Subscriber) bool) int {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	received := 0
+	for s := range b.channels[channel] {
+		if (accept == nil || accept(s)) && s.deliver(Message{Channel: channel, Payload: payload}) {
+			received++
+		}
+	}
+	for pattern, subscribers := range b.patterns {
+		if !MatchPattern(pattern, channel) {
+			continue
+		}
+		for s := range subscribers {
+			if (accept == nil || accept(s)) && s.deliver(Message{Pattern: pattern, Channel: channel, Payload: payload}) {
+				received++
+			}
+		}
+	}
+
+	return received
+}
+
+// NewSubscriber создает подписчика без подписок
+func (b *Broker) NewSubscriber() *Subscriber {
+	return &Subscriber{
+		broker:   b,
+		messages: make(chan Message, b.bufferSize),
+		done:     make(chan struct{}),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+}
+
+func (b *Broker) add(index map[string]map[*Subscriber]struct{}, name string, s *Subscriber) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if index[name] == nil {
+		index[name] = make(map[*Subscriber]struct{})
+	}
+	index[name][s] = struct{}{}
+}
+
+func (b *Broker) remove(index map[string]map[*Subscriber]struct{}, name string, s *Subscriber) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	delete(index[name], s)
+	if len(index[name]) == 0 {
+		delete(index, name)
+	}
+}
+
+// Subscriber подписки одного соединения. Сообщения копятся в буфере до отправки клиенту,
+// при переполнении буфера применяется политика SlowConsumer
+type Subscriber struct {
+	broker   *Broker
+	messages chan Message
+	// done закрывается, когда подписчик отключен
+	done      chan struct{}
+	closeOnce sync.Once
+	dropped   atomic.Int64
+	// namespace пространство ключей сессии при подписке, события других пространств не доставляются.
+	// Атомарное, так как Publish читает его под блокировкой брокера
+	namespace atomic.Pointer[string]
+
+	mtx      sync.Mutex
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+// Messages возвращает сообщения для отправки клиенту
+func (s *Subscriber) Messages() <-chan Message {
+	return s.messages
+}
+
+// Done закрывается, когда подписчик отключен как медленный или закрыт
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+// Count возвращает число подписок на каналы и шаблоны
+func (s *Subscriber) Count() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return len(s.channels) + len(s.patterns)
+}
+
+// Namespace возвращает пространство ключей, из которого подписчик подписался
+func (s *Subscriber) Namespace() string {
+	if namespace := s.namespace.Load(); namespace != nil {
+		return *namespace
+	}
+
+	return DefaultNamespace
+}
+
+// Subscribe подписывает на каналы
+func (s *Subscriber) Subscribe(channels ...string) Reply {
+	return s.change(pushSubscribe, s.channels, s.broker.channels, channels, true)
+}
+
+// PSubscribe подписывает на каналы, подходящие под glob шаблоны
+func (s *Subscriber) PSubscribe(patterns ...string) Reply {
+	return s.change(pushPSubscribe, s.patterns, s.broker.patterns, patterns, true)
+}
+
+// Unsubscribe отписывает от каналов, без аргументов от всех
+func (s *Subscriber) Unsubscribe(channels ...string) Reply {
+	return s.change(pushUnsubscribe, s.channels, s.broker.channels, channels, false)
+}
+
+// PUnsubscribe отписывает от шаблонов, без аргументов от всех
+func (s *Subscriber) PUnsubscribe(patterns ...string) Reply {
+	return s.change(pushPUnsubscribe, s.patterns, s.broker.patterns, patterns, false)
+}
+
+// change меняет подписки и возвращает подтверждение на каждый канал
+// с числом оставшихся подписок, как в Redis
+func (s *Subscriber) change(kind string, own map[string]struct{}, index map[string]map[*Subscriber]struct{},
+	names []string, subscribe bool,
+) Reply {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if !subscribe && len(names) == 0 {
+		names = slices.Sorted(maps.Keys(own))
+		if len(names) == 0 {
+			return pushReply(arrayReply(stringReply(kind), nilReply(), intReply(int64(len(s.channels)+len(s.patterns)))))
+		}
+	}
+
+	confirmations := make([]Reply, 0, len(names))
+	for _, name := range names {
+		if subscribe {
+			own[name] = struct{}{}
+			s.broker.add(index, name, s)
+		} else {
+			delete(own, name)
+			s.broker.remove(index, name, s)
+		}
+		confirmations = append(confirmations,
+			arrayReply(stringReply(kind), stringReply(name), intReply(int64(len(s.channels)+len(s.patterns)))))
+	}
+
+	return pushReply(confirmations...)
+}
+
+// Close отменяет все подписки
+func (s *Subscriber) Close() {
+	s.mtx.Lock()
+	for channel := range s.channels {
+		s.broker.remove(s.broker.channels, channel, s)
+	}
+	for pattern := range s.patterns {
+		s.broker.remove(s.broker.patterns, pattern, s)
+	}
+	clear(s.channels)
+	clear(s.patterns)
+	s.mtx.Unlock()
+
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// deliver кладет сообщение в буфер, не дожидаясь клиента
+func (s *Subscriber) deliver(m Message) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	select {
+	case s.messages <- m:
+		return true
+	default:
+	}
+
+	if s.broker.disconnect {
+		s.broker.logger.Warn().Msgf("subscriber buffer of %d messages is full, disconnecting", cap(s.messages))
+		// Close берет блокировку брокера, которую держит Publish, поэтому только сигнализируем
+		s.closeOnce.Do(func() { close(s.done) })
+		return false
+	}
+
+	if s.dropped.Add(1) == 1 {
+		s.broker.logger.Warn().Msgf("subscriber buffer of %d messages is full, dropping messages", cap(s.messages))
+	}
+
+	return false
+}
+
+// Reply сообщение в виде ответа push-режима
+func (m Message) Reply() Reply {
+	if m.Pattern != "" {
+		return pushReply(arrayReply(stringReply(pushPMessage), stringReply(m.Pattern), stringReply(m.Channel), stringReply(m.Payload)))
+	}
+
+	return pushReply(arrayReply(stringReply(pushMessage), stringReply(m.Channel), stringReply(m.Payload)))
+}
+
+// subscription выполняет команды подписки от имени сессии
+func (db *DB) subscription(ctx context.Context, command Command) (Reply, error) {
+	if db.broker == nil {
+		return Reply{}, errors.Wrap(ErrInvalidCommand, "pub/sub is disabled")
+	}
+
+	session := SessionFromContext(ctx)
+	if session == nil {
+		return Reply{}, ErrPushRequired
+	}
+	subscriber, err := session.subscribe(db.broker)
+	if err != nil {
+		return Reply{}, err
+	}
+	// пока есть подписки, SELECT запрещен, поэтому пространство ключей подписок одно
+	namespace := namespaceFromContext(ctx)
+	subscriber.namespace.Store(&namespace)
+
+	switch command.Type {
+	case Subscribe:
+		return subscriber.Subscribe(command.Args...), nil
+	case PSubscribe:
+		return subscriber.PSubscribe(command.Args...), nil
+	case Unsubscribe:
+		return subscriber.Unsubscribe(command.Args...), nil
+	default:
+		return subscriber.PUnsubscribe(command.Args...), nil
+	}
+}
+
+// checkPushMode запрещает в push-режиме команды, кроме подписок и PING:
+// ответы на них нельзя отличить от сообщений каналов
+func checkPushMode(ctx context.Context, command Command) error {
+	session := SessionFromContext(ctx)
+	if session == nil {
+		return nil
+	}
+	subscriber := session.Subscriber()
+	if subscriber == nil || subscriber.Count() == 0 {
+		return nil
+	}
+
+	switch command.Type {
+	case Subscribe, PSubscribe, Unsubscribe, PUnsubscribe, Ping:
+		return nil
+	default:
+		return errors.Wrapf(ErrInvalidCommand, "%s is not allowed while subscribed", command.Type)
+	}
+}
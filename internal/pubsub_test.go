@@ -0,0 +1,135 @@
+package internal_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+)
+
+func TestBroker_SlowConsumer(t *testing.T) {
+	tests := []struct {
+		policy       string
+		received     []int
+		disconnected bool
+	}{
+		{policy: internal.SlowConsumerDrop, received: []int{1, 1, 0}},
+		{policy: internal.SlowConsumerDisconnect, received: []int{1, 1, 0}, disconnected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			broker, err := internal.NewBroker(internal.PubSubConfig{BufferSize: 2, SlowConsumer: tt.policy}, zerolog.Nop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			subscriber := broker.NewSubscriber()
+			defer subscriber.Close()
+			subscriber.PSubscribe("news.*")
+
+			for i, want := range tt.received {
+				if got := broker.Publish("news.sport", "goal"); got != want {
+					t.Errorf("publish %d: expected %d receivers, got %d", i, want, got)
+				}
+			}
+
+			select {
+			case <-subscriber.Done():
+				if !tt.disconnected {
+					t.Error("expected subscriber to stay connected")
+				}
+			default:
+				if tt.disconnected {
+					t.Error("expected slow subscriber to be disconnected")
+				}
+			}
+
+			if m := <-subscriber.Messages(); m.Pattern != "news.*" || m.Channel != "news.sport" || m.Payload != "goal" {
+				t.Errorf("unexpected message %+v", m)
+			}
+		})
+	}
+}
+
+func TestServerTCP_PubSub(t *testing.T) {
+	logger := zerolog.Nop()
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker, err := internal.NewBroker(internal.PubSubConfig{BufferSize: 16, SlowConsumer: internal.SlowConsumerDrop}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := freeAddress(t)
+	server := internal.NewServerTCP(internal.NetworkConfig{
+		MaxConnections: 10,
+		IdleTimeout:    time.Minute,
+		Address:        address,
+	}, internal.NewDB(internal.NewParser(logger), storage, logger, internal.WithBroker(broker)), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = server.Run(ctx) }()
+	time.Sleep(100 * time.Millisecond)
+
+	subscriber, err := net.Dial("tcp", address.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscriber.Close()
+	reader := bufio.NewReader(subscriber)
+	_ = subscriber.SetDeadline(time.Now().Add(5 * time.Second))
+
+	expect := func(want string) {
+		t.Helper()
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != want {
+			t.Fatalf("expected %q, got %q", want, line)
+		}
+	}
+
+	// RESP позволяет передать сообщение с пробелами
+	if _, err = subscriber.Write([]byte("*2\r\n$9\r\nSUBSCRIBE\r\n$4\r\nnews\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	expect("*3\r\n")
+	expect("$9\r\n")
+	expect("subscribe\r\n")
+	expect("$4\r\n")
+	expect("news\r\n")
+	expect(":1\r\n")
+
+	if _, err = subscriber.Write([]byte("*2\r\n$3\r\nGET\r\n$1\r\na\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	expect("-SYNTAX GET is not allowed while subscribed: invalid command\r\n")
+
+	publisher, err := net.Dial("tcp", address.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+	if _, err = publisher.Write([]byte("PUBLISH news hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	if line, err := bufio.NewReader(publisher).ReadString('\n'); err != nil || line != "+1\n" {
+		t.Fatalf("expected 1 receiver, got %q %v", line, err)
+	}
+
+	expect("*3\r\n")
+	expect("$7\r\n")
+	expect("message\r\n")
+	expect("$4\r\n")
+	expect("news\r\n")
+	expect("$5\r\n")
+	expect("hello\r\n")
+}
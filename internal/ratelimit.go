@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Действия при превышении ограничения частоты
+const (
+	// RateLimitDelay задерживает запрос, пока не накопятся токены
+	RateLimitDelay = "delay"
+	// RateLimitReject отклоняет запрос с ErrRateLimited
+	RateLimitReject = "reject"
+)
+
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitConfig ограничения частоты запросов соединения и пользователя, 0 снимает ограничение.
+// Пользовательские ограничения общие для всех соединений пользователя
+type RateLimitConfig struct {
+	ConnectionQPS   int `yaml:"connection_qps" mapstructure:"connection_qps"`
+	ConnectionBytes int `yaml:"connection_bytes_per_second" mapstructure:"connection_bytes_per_second"`
+	UserQPS         int `yaml:"user_qps" mapstructure:"user_qps"`
+	UserBytes       int `yaml:"user_bytes_per_second" mapstructure:"user_bytes_per_second"`
+	// Action delay или reject, по умолчанию delay
+	Action string `yaml:"action" mapstructure:"action"`
+}
+
+func (c RateLimitConfig) validate() error {
+	if c.Action != "" && c.Action != RateLimitDelay && c.Action != RateLimitReject {
+		return errors.Errorf("unknown rate limit action %s", c.Action)
+	}
+
+	return nil
+}
+
+// tokenBucket корзина токенов, пополняется на rate токенов в секунду.
+// Емкость корзины равна rate, то есть допускается всплеск в объеме одной секунды
+type tokenBucket struct {
+	mtx    sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket возвращает nil, если ограничения нет
+func newTokenBucket(rate int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+
+	return &tokenBucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// take забирает n токенов и возвращает, сколько ждать, пока они накопятся.
+// Запрос больше емкости корзины ждет только полной корзины, иначе он не прошел бы никогда
+func (b *tokenBucket) take(n int) time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	now := time.Now()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	var wait time.Duration
+	if need := min(float64(n), b.rate); b.tokens < need {
+		wait = time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+	}
+	b.tokens -= float64(n)
+
+	return wait
+}
+
+// refund возвращает токены отклоненного запроса
+func (b *tokenBucket) refund(n int) {
+	if b == nil {
+		return
+	}
+
+	b.mtx.Lock()
+	b.tokens = min(b.rate, b.tokens+float64(n))
+	b.mtx.Unlock()
+}
+
+// UserRateLimits корзины пользователей, общие для всех соединений
+type UserRateLimits struct {
+	cfg     RateLimitConfig
+	mtx     sync.Mutex
+	buckets map[string][2]*tokenBucket
+}
+
+func NewUserRateLimits(cfg RateLimitConfig) *UserRateLimits {
+	return &UserRateLimits{cfg: cfg, buckets: make(map[string][2]*tokenBucket)}
+}
+
+// ServerOption настраивает TCP-сервер или HTTP шлюз
+type ServerOption func(opts *serverOptions)
+
+type serverOptions struct {
+	userLimits *UserRateLimits
+	stats      *ServerCounters
+}
+
+// WithUserRateLimits задает ограничения пользователей, общие для нескольких серверов.
+// Без нее у каждого сервера свои ограничения
+func WithUserRateLimits(limits *UserRateLimits) ServerOption {
+	return func(opts *serverOptions) { opts.userLimits = limits }
+}
+
+// WithServerCounters задает счетчики, общие для нескольких серверов и INFO.
+// Без нее у каждого сервера свои счетчики
+func WithServerCounters(stats *ServerCounters) ServerOption {
+	return func(opts *serverOptions) { opts.stats = stats }
+}
+
+func newServerOptions(cfg RateLimitConfig, opts []ServerOption) serverOptions {
+	var options serverOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.userLimits == nil {
+		options.userLimits = NewUserRateLimits(cfg)
+	}
+	if options.stats == nil {
+		options.stats = NewServerCounters()
+	}
+
+	return options
+}
+
+// get возвращает корзины запросов и байтов пользователя, для неподтвержденного пользователя nil
+func (u *UserRateLimits) get(user string) (*tokenBucket, *tokenBucket) {
+	if user == "" || u.cfg.UserQPS <= 0 && u.cfg.UserBytes <= 0 {
+		return nil, nil
+	}
+
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	buckets, has := u.buckets[user]
+	if !has {
+		buckets = [2]*tokenBucket{newTokenBucket(u.cfg.UserQPS), newTokenBucket(u.cfg.UserBytes)}
+		u.buckets[user] = buckets
+	}
+
+	return buckets[0], buckets[1]
+}
+
+// rateLimiter ограничения одного соединения
+type rateLimiter struct {
+	queries *tokenBucket
+	bytes   *tokenBucket
+	users   *UserRateLimits
+	reject  bool
+}
+
+func newRateLimiter(cfg RateLimitConfig, users *UserRateLimits) *rateLimiter {
+	return &rateLimiter{
+		queries: newTokenBucket(cfg.ConnectionQPS),
+		bytes:   newTokenBucket(cfg.ConnectionBytes),
+		users:   users,
+		reject:  cfg.Action == RateLimitReject,
+	}
+}
+
+// newUserRateLimiter ограничивает только пользователя, для запросов без постоянного соединения
+func newUserRateLimiter(cfg RateLimitConfig, users *UserRateLimits) *rateLimiter {
+	return &rateLimiter{users: users, reject: cfg.Action == RateLimitReject}
+}
+
+// take учитывает запрос размером size байт и возвращает задержку перед его выполнением.
+// При действии reject вместо задержки возвращается ErrRateLimited, а токены возвращаются
+func (l *rateLimiter) take(user string, size int) (time.Duration, error) {
+	userQueries, userBytes := l.users.get(user)
+	buckets := [...]*tokenBucket{l.queries, l.bytes, userQueries, userBytes}
+	amounts := [...]int{1, size, 1, size}
+
+	var wait time.Duration
+	for i, bucket := range buckets {
+		wait = max(wait, bucket.take(amounts[i]))
+	}
+
+	if wait > 0 && l.reject {
+		for i, bucket := range buckets {
+			bucket.refund(amounts[i])
+		}
+		return 0, errors.Wrapf(ErrRateLimited, "retry in %s", wait.Round(time.Millisecond))
+	}
+
+	return wait, nil
+}
+
+// limit применяет ограничения к запросу размером size байт. ErrRateLimited отправляется клиенту,
+// остальные ошибки означают, что соединение нужно закрыть
+func (t *ServerTCP) limit(ctx context.Context, limiter *rateLimiter, size int) error {
+	wait, err := limiter.take(SessionFromContext(ctx).User(), size)
+	if err != nil {
+		t.stats.rateLimited.Add(1)
+		return err
+	}
+	if wait == 0 {
+		return nil
+	}
+
+	t.stats.delayed.Add(1)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.stopping:
+		return errors.New("server is stopping")
+	}
+}
@@ -0,0 +1,80 @@
+package internal_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+)
+
+func TestServerTCP_RateLimit(t *testing.T) {
+	tests := []struct {
+		action    string
+		responses []string
+		stats     internal.ServerStats
+	}{
+		{
+			action:    internal.RateLimitReject,
+			responses: []string{"+PONG", "+PONG", "-RATE_LIMITED"},
+			stats:     internal.ServerStats{Connections: 1, Queries: 2, RateLimited: 1},
+		},
+		{
+			action:    internal.RateLimitDelay,
+			responses: []string{"+PONG", "+PONG", "+PONG"},
+			stats:     internal.ServerStats{Connections: 1, Queries: 3, Delayed: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			logger := zerolog.Nop()
+			storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, nil, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			address := freeAddress(t)
+			server := internal.NewServerTCP(internal.NetworkConfig{
+				MaxConnections: 10,
+				IdleTimeout:    time.Minute,
+				Address:        address,
+				RateLimit:      internal.RateLimitConfig{ConnectionQPS: 2, Action: tt.action},
+			}, internal.NewDB(internal.NewParser(logger), storage, logger), logger)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() { _ = server.Run(ctx) }()
+			time.Sleep(100 * time.Millisecond)
+
+			conn, err := net.Dial("tcp", address.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			if _, err = conn.Write([]byte(strings.Repeat("PING\n", len(tt.responses)))); err != nil {
+				t.Fatal(err)
+			}
+			reader := bufio.NewReader(conn)
+			for i, want := range tt.responses {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.HasPrefix(line, want) {
+					t.Errorf("response %d: expected %s, got %q", i, want, line)
+				}
+			}
+
+			if stats := server.Stats(); stats != tt.stats {
+				t.Errorf("expected stats %+v, got %+v", tt.stats, stats)
+			}
+		})
+	}
+}
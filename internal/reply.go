@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type ReplyType int
+
+const (
+	// StatusReply короткий статус, например ok
+	StatusReply ReplyType = iota
+	// StringReply значение
+	StringReply
+	// IntReply целое число
+	IntReply
+	// NilReply отсутствующее значение
+	NilReply
+	// ArrayReply список ответов
+	ArrayReply
+	// MapReply список пар ключ значение, в RESP3 передается как map
+	MapReply
+	// PushReply сообщения push-режима, каждый элемент отправляется клиенту отдельно,
+	// в RESP3 с типом push
+	PushReply
+)
+
+// Reply типизированный результат запроса, не зависящий от протокола
+type Reply struct {
+	Type  ReplyType
+	Str   string
+	Int   int64
+	Array []Reply
+}
+
+func okReply() Reply {
+	return statusReply("ok")
+}
+
+func statusReply(status string) Reply {
+	return Reply{Type: StatusReply, Str: status}
+}
+
+func stringReply(s string) Reply {
+	return Reply{Type: StringReply, Str: s}
+}
+
+func intReply(n int64) Reply {
+	return Reply{Type: IntReply, Int: n}
+}
+
+func boolReply(b bool) Reply {
+	if b {
+		return intReply(1)
+	}
+
+	return intReply(0)
+}
+
+func nilReply() Reply {
+	return Reply{Type: NilReply}
+}
+
+func arrayReply(items ...Reply) Reply {
+	return Reply{Type: ArrayReply, Array: items}
+}
+
+func pushReply(items ...Reply) Reply {
+	return Reply{Type: PushReply, Array: items}
+}
+
+// mapReply пары ключ значение, записанные подряд
+func mapReply(pairs []string) Reply {
+	reply := listReply(pairs)
+	reply.Type = MapReply
+
+	return reply
+}
+
+// listReply список значений
+func listReply(values []string) Reply {
+	items := make([]Reply, len(values))
+	for i, value := range values {
+		items[i] = stringReply(value)
+	}
+
+	return arrayReply(items...)
+}
+
+// valuesReply список значений, для отсутствующих has[i] == false
+func valuesReply(values []string, has []bool) Reply {
+	items := make([]Reply, len(values))
+	for i, value := range values {
+		items[i] = stringReply(value)
+		if !has[i] {
+			items[i] = nilReply()
+		}
+	}
+
+	return arrayReply(items...)
+}
+
+// membersReply список элементов sorted set
+func membersReply(members []ScoredMember) Reply {
+	items := make([]Reply, len(members))
+	for i, m := range members {
+		items[i] = stringReply(m.Member)
+	}
+
+	return arrayReply(items...)
+}
+
+// String форматирует ответ в одну строку текстового протокола:
+// значения списка разделяются ValuesDelim, вложенные списки разворачиваются,
+// отсутствующее значение заменяется на NilValue, пустой список на EmptyList.
+// Значения с пробелами, управляющими символами или кавычками записываются в кавычках
+// с экранированием, как строки Go, чтобы не разрывать строку ответа и не сливаться с соседними
+func (r Reply) String() string {
+	switch r.Type {
+	case StringReply:
+		if r.Str == "" {
+			return EmptyString
+		}
+		if needsQuoting(r.Str) {
+			return strconv.Quote(r.Str)
+		}
+		return r.Str
+	case IntReply:
+		return strconv.FormatInt(r.Int, 10)
+	case NilReply:
+		return NilValue
+	case ArrayReply, MapReply, PushReply:
+		values := r.flatten(nil)
+		if len(values) == 0 {
+			return EmptyList
+		}
+		return strings.Join(values, ValuesDelim)
+	default:
+		return r.Str
+	}
+}
+
+func needsQuoting(s string) bool {
+	return !utf8.ValidString(s) || strings.ContainsFunc(s, func(r rune) bool {
+		return r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r)
+	})
+}
+
+func (r Reply) flatten(values []string) []string {
+	if r.Type != ArrayReply && r.Type != MapReply && r.Type != PushReply {
+		return append(values, r.String())
+	}
+
+	for _, item := range r.Array {
+		values = item.flatten(values)
+	}
+
+	return values
+}
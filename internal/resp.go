@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Типы значений RESP
+const (
+	respStatus = '+'
+	respError  = '-'
+	respInt    = ':'
+	respBulk   = '$'
+	respArray  = '*'
+	respNull   = '_'
+	respMap    = '%'
+	respPush   = '>'
+)
+
+// Версии RESP, RESP3 включается командой HELLO 3
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
+const (
+	respCRLF = "\r\n"
+	// respHello команда выбора версии протокола, обрабатывается на уровне соединения
+	respHello = "HELLO"
+
+	// maxRespBulkLen ограничение протокола на размер запроса
+	maxRespBulkLen = 512 * 1024 * 1024
+	// respMinBulkSize размер пустого bulk аргумента "$0\r\n\r\n"
+	respMinBulkSize = 6
+)
+
+var ErrProtocol = errors.New("protocol error")
+
+// ReadRESPCommand читает одну команду RESP: массив bulk строк
+// или inline команду, аргументы которой разделены пробелами.
+// Команда больше maxSize байт отклоняется с ErrMessageTooLarge до выделения памяти,
+// maxSize <= 0 оставляет только ограничение протокола
+func ReadRESPCommand(r *bufio.Reader, maxSize int) ([]string, error) {
+	if maxSize <= 0 || maxSize > maxRespBulkLen {
+		maxSize = maxRespBulkLen
+	}
+
+	line, err := ReadLine(r, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(strings.TrimSuffix(line, DelimStr), "\r")
+
+	if line == "" || line[0] != respArray {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, errors.Wrapf(ErrProtocol, "invalid multibulk length %q", line[1:])
+	}
+	// пустой аргумент занимает не меньше respMinBulkSize байт
+	if n > maxSize/respMinBulkSize {
+		return nil, errors.Wrapf(ErrMessageTooLarge, "%d arguments exceed %d bytes", n, maxSize)
+	}
+
+	args := make([]string, 0, max(n, 0))
+	size := len(line)
+	for range n {
+		arg, err := readRESPBulk(r, maxSize-size)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		size += len(arg) + respMinBulkSize
+	}
+
+	return args, nil
+}
+
+func readRESPBulk(r *bufio.Reader, maxSize int) (string, error) {
+	line, err := ReadLine(r, max(maxSize, respMinBulkSize))
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(strings.TrimSuffix(line, DelimStr), "\r")
+
+	if line == "" || line[0] != respBulk {
+		return "", errors.Wrapf(ErrProtocol, "expected '%c', got %q", respBulk, line)
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 {
+		return "", errors.Wrapf(ErrProtocol, "invalid bulk length %q", line[1:])
+	}
+	if n > maxSize {
+		return "", errors.Wrapf(ErrMessageTooLarge, "bulk length %d exceeds remaining %d bytes", n, maxSize)
+	}
+
+	buf := make([]byte, n+len(respCRLF))
+	if _, err = io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	if string(buf[n:]) != respCRLF {
+		return "", errors.Wrap(ErrProtocol, "bulk string must end with CRLF")
+	}
+
+	return string(buf[:n]), nil
+}
+
+// WriteRESPReply кодирует ответ в RESP указанной версии
+func WriteRESPReply(w *bufio.Writer, reply Reply, version int) error {
+	switch reply.Type {
+	case StatusReply:
+		writeRESPLine(w, respStatus, reply.Str)
+	case StringReply:
+		writeRESPLine(w, respBulk, strconv.Itoa(len(reply.Str)))
+		_, _ = w.WriteString(reply.Str)
+		_, _ = w.WriteString(respCRLF)
+	case IntReply:
+		writeRESPLine(w, respInt, strconv.FormatInt(reply.Int, 10))
+	case NilReply:
+		if version >= RESP3 {
+			writeRESPLine(w, respNull, "")
+		} else {
+			writeRESPLine(w, respBulk, "-1")
+		}
+	case PushReply:
+		for _, item := range reply.Array {
+			if version >= RESP3 {
+				writeRESPLine(w, respPush, strconv.Itoa(len(item.Array)))
+				for _, field := range item.Array {
+					if err := WriteRESPReply(w, field, version); err != nil {
+						return err
+					}
+				}
+			} else if err := WriteRESPReply(w, item, version); err != nil {
+				return err
+			}
+		}
+	case ArrayReply, MapReply:
+		if reply.Type == MapReply && version >= RESP3 {
+			writeRESPLine(w, respMap, strconv.Itoa(len(reply.Array)/2))
+		} else {
+			writeRESPLine(w, respArray, strconv.Itoa(len(reply.Array)))
+		}
+		for _, item := range reply.Array {
+			if err := WriteRESPReply(w, item, version); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.Errorf("unknown reply type %d", reply.Type)
+	}
+
+	return nil
+}
+
+// WriteRESPError кодирует ошибку в RESP, первым словом сообщения идет код ошибки
+func WriteRESPError(w *bufio.Writer, err error) {
+	msg := strings.NewReplacer("\r", " ", "\n", " ").Replace(err.Error())
+	writeRESPLine(w, respError, string(ErrorCodeOf(err))+" "+msg)
+}
+
+func writeRESPLine(w *bufio.Writer, prefix byte, s string) {
+	_ = w.WriteByte(prefix)
+	_, _ = w.WriteString(s)
+	_, _ = w.WriteString(respCRLF)
+}
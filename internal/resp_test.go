@@ -0,0 +1,77 @@
+package internal_test
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"key-value-storage/internal"
+)
+
+func TestReadRESPCommand(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("*3\r\n$3\r\nSET\r\n$5\r\nk e y\r\n$3\r\na\nb\r\nPING\r\n*1\r\n$2\r\nGET\r\n"))
+
+	args, err := internal.ReadRESPCommand(r, 0)
+	if err != nil || !reflect.DeepEqual(args, []string{"SET", "k e y", "a\nb"}) {
+		t.Fatalf("unexpected command %q %v", args, err)
+	}
+
+	args, err = internal.ReadRESPCommand(r, 0)
+	if err != nil || !reflect.DeepEqual(args, []string{"PING"}) {
+		t.Fatalf("unexpected inline command %q %v", args, err)
+	}
+
+	if _, err = internal.ReadRESPCommand(r, 0); !errors.Is(err, internal.ErrProtocol) {
+		t.Fatalf("expected protocol error, got %v", err)
+	}
+
+	t.Run("too large", func(t *testing.T) {
+		for _, cmd := range []string{
+			"*2\r\n$3\r\nGET\r\n$20\r\n",
+			"*100\r\n",
+			"GET " + strings.Repeat("k", 100) + "\r\n",
+		} {
+			_, err := internal.ReadRESPCommand(bufio.NewReader(strings.NewReader(cmd)), 16)
+			if !errors.Is(err, internal.ErrMessageTooLarge) {
+				t.Fatalf("expected too large error for %q, got %v", cmd, err)
+			}
+		}
+	})
+}
+
+func TestWriteRESPReply(t *testing.T) {
+	reply := internal.Reply{Type: internal.ArrayReply, Array: []internal.Reply{
+		{Type: internal.StringReply, Str: "v"},
+		{Type: internal.NilReply},
+		{Type: internal.IntReply, Int: 7},
+	}}
+
+	tests := []struct {
+		version  int
+		expected string
+	}{
+		{internal.RESP2, "*3\r\n$1\r\nv\r\n$-1\r\n:7\r\n"},
+		{internal.RESP3, "*3\r\n$1\r\nv\r\n_\r\n:7\r\n"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		if err := internal.WriteRESPReply(w, reply, tt.version); err != nil {
+			t.Fatal(err)
+		}
+		_ = w.Flush()
+
+		if buf.String() != tt.expected {
+			t.Fatalf("RESP%d: expected %q, got %q", tt.version, tt.expected, buf.String())
+		}
+	}
+
+	if reply.String() != "v (nil) 7" {
+		t.Fatalf("unexpected text reply %q", reply.String())
+	}
+}
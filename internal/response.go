@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorCode стабильный код ошибки в ответе сервера
+type ErrorCode string
+
+const (
+	CodeNotFound           ErrorCode = "NOT_FOUND"
+	CodeSyntax             ErrorCode = "SYNTAX"
+	CodeWrongType          ErrorCode = "WRONGTYPE"
+	CodeNotNumber          ErrorCode = "NOT_NUMBER"
+	CodeTimeout            ErrorCode = "TIMEOUT"
+	CodeTooManyConnections ErrorCode = "TOO_MANY_CONNECTIONS"
+	CodeProtocol           ErrorCode = "PROTOCOL"
+	CodeTooLarge           ErrorCode = "TOO_LARGE"
+	CodeNoAuth             ErrorCode = "NOAUTH"
+	CodeWrongPass          ErrorCode = "WRONGPASS"
+	CodeLocked             ErrorCode = "LOCKED"
+	CodeNoPermission       ErrorCode = "NOPERM"
+	CodeRateLimited        ErrorCode = "RATE_LIMITED"
+	CodePushRequired       ErrorCode = "NOPUSH"
+	CodeInternal           ErrorCode = "INTERNAL"
+)
+
+// Префиксы строки ответа: успешный ответ "+<значение>", ошибка "-<код> <сообщение>"
+const (
+	successPrefix = '+'
+	errorPrefix   = '-'
+)
+
+var ErrTooManyConnections = errors.New("too many connections")
+
+// codeErrors сопоставляет коды с ошибками, по которым они определяются
+var codeErrors = map[ErrorCode]error{
+	CodeNotFound:           ErrNotFound,
+	CodeSyntax:             ErrInvalidCommand,
+	CodeWrongType:          ErrWrongType,
+	CodeNotNumber:          ErrNotNumber,
+	CodeTimeout:            ErrTimeout,
+	CodeTooManyConnections: ErrTooManyConnections,
+	CodeProtocol:           ErrProtocol,
+	CodeTooLarge:           ErrMessageTooLarge,
+	CodeNoAuth:             ErrAuthRequired,
+	CodeWrongPass:          ErrAuthFailed,
+	CodeLocked:             ErrAuthLocked,
+	CodeNoPermission:       ErrNoPermission,
+	CodeRateLimited:        ErrRateLimited,
+	CodePushRequired:       ErrPushRequired,
+}
+
+// ErrorCodeOf возвращает код ошибки, неизвестные ошибки считаются внутренними
+func ErrorCodeOf(err error) ErrorCode {
+	for _, code := range []ErrorCode{
+		CodeNotFound, CodeSyntax, CodeWrongType, CodeNotNumber, CodeTimeout, CodeTooManyConnections, CodeProtocol,
+		CodeTooLarge, CodeNoAuth, CodeWrongPass, CodeLocked, CodeNoPermission, CodeRateLimited, CodePushRequired,
+	} {
+		if errors.Is(err, codeErrors[code]) {
+			return code
+		}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CodeTimeout
+	}
+
+	return CodeInternal
+}
+
+// ResponseError ошибка, полученная от сервера.
+// errors.Is сравнивает ее с ошибкой, соответствующей коду, например ErrNotFound
+type ResponseError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *ResponseError) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+func (e *ResponseError) Is(target error) bool {
+	codeErr, has := codeErrors[e.Code]
+
+	return has && codeErr == target
+}
+
+// EncodeResponse кодирует результат запроса в строку ответа без разделителя
+func EncodeResponse(resp string, err error) string {
+	if err != nil {
+		// сообщение не должно разрывать строку ответа
+		msg := strings.ReplaceAll(err.Error(), DelimStr, " ")
+		return string(errorPrefix) + string(ErrorCodeOf(err)) + " " + msg
+	}
+
+	return string(successPrefix) + resp
+}
+
+// DecodeResponse разбирает строку ответа без разделителя, ошибка сервера возвращается как *ResponseError
+func DecodeResponse(line string) (string, error) {
+	if line == "" {
+		return "", errors.New("empty response")
+	}
+
+	switch line[0] {
+	case successPrefix:
+		return line[1:], nil
+	case errorPrefix:
+		code, msg, _ := strings.Cut(line[1:], " ")
+		return "", &ResponseError{Code: ErrorCode(code), Message: msg}
+	default:
+		return "", errors.Errorf("malformed response %q", line)
+	}
+}
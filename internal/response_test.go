@@ -0,0 +1,48 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"key-value-storage/internal"
+)
+
+func TestEncodeDecodeResponse(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		line := internal.EncodeResponse("-5", nil)
+		resp, err := internal.DecodeResponse(line)
+		if err != nil || resp != "-5" {
+			t.Fatalf("expected -5, got %q %v", resp, err)
+		}
+	})
+
+	tests := []struct {
+		err  error
+		code internal.ErrorCode
+	}{
+		{errors.Wrap(internal.ErrNotFound, "failed to get value"), internal.CodeNotFound},
+		{errors.Wrap(internal.ErrInvalidCommand, "failed to parse command"), internal.CodeSyntax},
+		{internal.ErrWrongType, internal.CodeWrongType},
+		{errors.Wrap(internal.ErrNotNumber, "value is not an integer"), internal.CodeNotNumber},
+		{internal.ErrTimeout, internal.CodeTimeout},
+		{errors.New("disk is on fire\nreally"), internal.CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.code), func(t *testing.T) {
+			_, err := internal.DecodeResponse(internal.EncodeResponse("", tt.err))
+
+			var respErr *internal.ResponseError
+			if !errors.As(err, &respErr) {
+				t.Fatalf("expected *ResponseError, got %v", err)
+			}
+			if respErr.Code != tt.code {
+				t.Fatalf("expected code %s, got %s", tt.code, respErr.Code)
+			}
+			if tt.code != internal.CodeInternal && !errors.Is(err, errors.Cause(tt.err)) {
+				t.Fatalf("expected %v to match %v", err, errors.Cause(tt.err))
+			}
+		})
+	}
+}
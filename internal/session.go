@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultNamespace пространство ключей, выбранное при подключении
+const DefaultNamespace = "0"
+
+// maxNamespaceLength предельная длина имени пространства ключей
+const maxNamespaceLength = 64
+
+// Session состояние клиентского соединения. Команды одного соединения
+// двоичного протокола выполняются параллельно, поэтому доступ к состоянию синхронизирован
+type Session struct {
+	// Addr адрес клиента, задается при создании сессии
+	Addr string
+
+	mtx sync.RWMutex
+	// namespace пространство ключей, выбранное командой SELECT
+	namespace string
+	// user пользователь, подтвержденный командой AUTH или сертификатом клиента
+	user string
+	// trusted сессия локальной консоли, права пользователей к ней не применяются
+	trusted bool
+	// push соединение умеет отправлять сообщения каналов, подписки разрешены
+	push       bool
+	subscriber *Subscriber
+
+	// disconnected закрывается, когда клиент отключился
+	disconnected   chan struct{}
+	disconnectOnce sync.Once
+}
+
+func NewSession() *Session {
+	return &Session{
+		namespace:    DefaultNamespace,
+		disconnected: make(chan struct{}),
+	}
+}
+
+// Namespace возвращает выбранное пространство ключей
+func (s *Session) Namespace() string {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return s.namespace
+}
+
+// Select выбирает пространство ключей для следующих команд
+func (s *Session) Select(namespace string) {
+	s.mtx.Lock()
+	s.namespace = namespace
+	s.mtx.Unlock()
+}
+
+// User возвращает подтвержденного пользователя соединения или пустую строку
+func (s *Session) User() string {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return s.user
+}
+
+// SetUser запоминает подтвержденного пользователя соединения
+func (s *Session) SetUser(user string) {
+	s.mtx.Lock()
+	s.user = user
+	s.mtx.Unlock()
+}
+
+// Trust снимает с сессии проверку прав, используется для локальной консоли
+func (s *Session) Trust() {
+	s.mtx.Lock()
+	s.trusted = true
+	s.mtx.Unlock()
+}
+
+// Trusted сообщает, что права пользователей к сессии не применяются
+func (s *Session) Trusted() bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return s.trusted
+}
+
+// AllowPush разрешает подписки: соединение будет отправлять сообщения каналов
+func (s *Session) AllowPush() {
+	s.mtx.Lock()
+	s.push = true
+	s.mtx.Unlock()
+}
+
+// Subscriber возвращает подписчика соединения или nil
+func (s *Session) Subscriber() *Subscriber {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return s.subscriber
+}
+
+// subscribe возвращает подписчика соединения, создавая его при первой подписке
+func (s *Session) subscribe(broker *Broker) (*Subscriber, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if !s.push {
+		return nil, ErrPushRequired
+	}
+	if s.subscriber == nil {
+		s.subscriber = broker.NewSubscriber()
+	}
+
+	return s.subscriber, nil
+}
+
+// Disconnected закрывается, когда клиент отключился, блокирующие команды при этом прерываются
+func (s *Session) Disconnected() <-chan struct{} {
+	return s.disconnected
+}
+
+// Disconnect отмечает, что клиент отключился
+func (s *Session) Disconnect() {
+	s.disconnectOnce.Do(func() { close(s.disconnected) })
+}
+
+// Close освобождает ресурсы сессии при закрытии соединения
+func (s *Session) Close() {
+	s.Disconnect()
+	if subscriber := s.Subscriber(); subscriber != nil {
+		subscriber.Close()
+	}
+}
+
+type sessionCtxKey struct{}
+
+// ContextWithSession привязывает сессию соединения к контексту запросов
+func ContextWithSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionCtxKey{}, session)
+}
+
+// SessionFromContext возвращает сессию соединения или nil
+func SessionFromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionCtxKey{}).(*Session)
+
+	return session
+}
+
+// namespaceFromContext возвращает пространство ключей сессии или DefaultNamespace
+func namespaceFromContext(ctx context.Context) string {
+	if session := SessionFromContext(ctx); session != nil {
+		if namespace := session.Namespace(); namespace != "" {
+			return namespace
+		}
+	}
+
+	return DefaultNamespace
+}
@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"cmp"
+	"math/rand/v2"
+)
+
+const (
+	skipListMaxLevel = 32
+	// skipListP вероятность перехода узла на следующий уровень
+	skipListP = 0.25
+)
+
+type skipListLevel struct {
+	next *skipListNode
+	// span количество узлов нижнего уровня, которые перепрыгивает ссылка next
+	span int
+}
+
+type skipListNode struct {
+	member string
+	score  float64
+	levels []skipListLevel
+}
+
+// skipList упорядочен по score, при равных score по member.
+// Ширина ссылок позволяет находить ранг и элемент по рангу за O(log n)
+type skipList struct {
+	head   *skipListNode
+	level  int
+	length int
+}
+
+func newSkipList() *skipList {
+	return &skipList{
+		head:   &skipListNode{levels: make([]skipListLevel, skipListMaxLevel)},
+		level:  1,
+		length: 0,
+	}
+}
+
+func (l *skipList) insert(score float64, member string) {
+	var update [skipListMaxLevel]*skipListNode
+	var rank [skipListMaxLevel]int
+
+	node := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		if i < l.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for next := node.levels[i].next; next != nil && compareNode(next, score, member) < 0; next = node.levels[i].next {
+			rank[i] += node.levels[i].span
+			node = next
+		}
+		update[i] = node
+	}
+
+	level := randomLevel()
+	if level > l.level {
+		for i := l.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = l.head
+			update[i].levels[i].span = l.length
+		}
+		l.level = level
+	}
+
+	inserted := &skipListNode{member: member, score: score, levels: make([]skipListLevel, level)}
+	for i := 0; i < level; i++ {
+		inserted.levels[i].next = update[i].levels[i].next
+		update[i].levels[i].next = inserted
+
+		inserted.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+
+	for i := level; i < l.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	l.length++
+}
+
+func (l *skipList) delete(score float64, member string) bool {
+	var update [skipListMaxLevel]*skipListNode
+
+	node := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for next := node.levels[i].next; next != nil && compareNode(next, score, member) < 0; next = node.levels[i].next {
+			node = next
+		}
+		update[i] = node
+	}
+
+	deleted := node.levels[0].next
+	if deleted == nil || compareNode(deleted, score, member) != 0 {
+		return false
+	}
+
+	for i := 0; i < l.level; i++ {
+		if update[i].levels[i].next == deleted {
+			update[i].levels[i].span += deleted.levels[i].span - 1
+			update[i].levels[i].next = deleted.levels[i].next
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+
+	for l.level > 1 && l.head.levels[l.level-1].next == nil {
+		l.level--
+	}
+	l.length--
+
+	return true
+}
+
+// rank возвращает позицию элемента начиная с 0 или -1 если его нет
+func (l *skipList) rank(score float64, member string) int {
+	rank := 0
+	node := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for next := node.levels[i].next; next != nil && compareNode(next, score, member) <= 0; next = node.levels[i].next {
+			rank += node.levels[i].span
+			node = next
+		}
+
+		if node != l.head && node.member == member {
+			return rank - 1
+		}
+	}
+
+	return -1
+}
+
+// byRank возвращает элемент на позиции rank начиная с 0
+func (l *skipList) byRank(rank int) *skipListNode {
+	if rank < 0 || rank >= l.length {
+		return nil
+	}
+
+	traversed := 0
+	node := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for node.levels[i].next != nil && traversed+node.levels[i].span <= rank+1 {
+			traversed += node.levels[i].span
+			node = node.levels[i].next
+		}
+
+		if traversed == rank+1 {
+			return node
+		}
+	}
+
+	return nil
+}
+
+// firstFrom возвращает первый элемент со score не меньше minScore
+func (l *skipList) firstFrom(minScore float64) *skipListNode {
+	node := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for next := node.levels[i].next; next != nil && next.score < minScore; next = node.levels[i].next {
+			node = next
+		}
+	}
+
+	return node.levels[0].next
+}
+
+// firstAfter возвращает первый элемент строго больше (score, member)
+func (l *skipList) firstAfter(score float64, member string) *skipListNode {
+	node := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for next := node.levels[i].next; next != nil && compareNode(next, score, member) <= 0; next = node.levels[i].next {
+			node = next
+		}
+	}
+
+	return node.levels[0].next
+}
+
+func compareNode(node *skipListNode, score float64, member string) int {
+	if c := cmp.Compare(node.score, score); c != 0 {
+		return c
+	}
+
+	return cmp.Compare(node.member, member)
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && rand.Float64() < skipListP {
+		level++
+	}
+
+	return level
+}
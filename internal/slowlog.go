@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Подкоманды SLOWLOG
+const (
+	SlowLogGet   = "GET"
+	SlowLogLen   = "LEN"
+	SlowLogReset = "RESET"
+)
+
+// Ограничения записи аргументов, чтобы большие значения не занимали журнал
+const (
+	slowLogMaxArgs   = 32
+	slowLogMaxArgLen = 128
+	// slowLogDefaultGet число записей SLOWLOG GET без аргумента
+	slowLogDefaultGet = 10
+)
+
+// SlowLogConfig настройки журнала медленных запросов
+type SlowLogConfig struct {
+	// Threshold запросы дольше порога попадают в журнал, 0 выключает журнал
+	Threshold time.Duration `yaml:"threshold" mapstructure:"threshold"`
+	// MaxLen число хранимых записей, старые записи вытесняются новыми
+	MaxLen int `yaml:"max_len" mapstructure:"max_len"`
+	// Log дополнительно пишет медленные запросы в лог
+	Log bool `yaml:"log" mapstructure:"log"`
+}
+
+// SlowLogEntry запись о медленном запросе
+type SlowLogEntry struct {
+	ID       int64
+	Time     time.Time
+	Duration time.Duration
+	Addr     string
+	Command  CommandType
+	// Args аргументы команды, обрезанные до slowLogMaxArgs штук по slowLogMaxArgLen байт
+	Args []string
+}
+
+// SlowQueryLog кольцевой буфер медленных запросов
+type SlowQueryLog struct {
+	threshold time.Duration
+	log       bool
+	logger    zerolog.Logger
+
+	mtx     sync.Mutex
+	entries []SlowLogEntry
+	// next позиция следующей записи, count число хранимых записей
+	next   int
+	count  int
+	nextID int64
+}
+
+// NewSlowQueryLog возвращает nil, если журнал выключен: тогда запросы не замеряются
+func NewSlowQueryLog(cfg SlowLogConfig, logger zerolog.Logger) *SlowQueryLog {
+	if cfg.Threshold <= 0 || cfg.MaxLen <= 0 {
+		return nil
+	}
+
+	return &SlowQueryLog{
+		threshold: cfg.Threshold,
+		log:       cfg.Log,
+		logger:    logger,
+		entries:   make([]SlowLogEntry, cfg.MaxLen),
+	}
+}
+
+// record записывает команду, если она выполнялась дольше порога
+func (l *SlowQueryLog) record(ctx context.Context, command Command, start time.Time) {
+	duration := time.Since(start)
+	if duration < l.threshold {
+		return
+	}
+
+	entry := SlowLogEntry{
+		Time:     start,
+		Duration: duration,
+		Command:  command.Type,
+		Args:     truncateArgs(redactArgs(append([]string{string(command.Type)}, command.Args...))[1:]),
+	}
+	if session := SessionFromContext(ctx); session != nil {
+		entry.Addr = session.Addr
+	}
+
+	l.mtx.Lock()
+	entry.ID = l.nextID
+	l.nextID++
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % len(l.entries)
+	l.count = min(l.count+1, len(l.entries))
+	l.mtx.Unlock()
+
+	if l.log {
+		l.logger.Warn().
+			Int64("id", entry.ID).
+			Dur("duration", entry.Duration).
+			Str("client", entry.Addr).
+			Str("command", string(entry.Command)).
+			Strs("args", entry.Args).
+			Msg("slow query")
+	}
+}
+
+// Get возвращает до n последних записей, новые первыми
+func (l *SlowQueryLog) Get(n int) []SlowLogEntry {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	n = min(n, l.count)
+	entries := make([]SlowLogEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		entries = append(entries, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+
+	return entries
+}
+
+// Len возвращает число хранимых записей
+func (l *SlowQueryLog) Len() int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	return l.count
+}
+
+// Reset очищает журнал, номера записей продолжают расти
+func (l *SlowQueryLog) Reset() {
+	l.mtx.Lock()
+	clear(l.entries)
+	l.next = 0
+	l.count = 0
+	l.mtx.Unlock()
+}
+
+func truncateArgs(args []string) []string {
+	truncated := make([]string, 0, min(len(args), slowLogMaxArgs))
+	for i, arg := range args {
+		if i == slowLogMaxArgs-1 && len(args) > slowLogMaxArgs {
+			truncated = append(truncated, "... ("+strconv.Itoa(len(args)-i)+" more arguments)")
+			break
+		}
+		if len(arg) > slowLogMaxArgLen {
+			arg = arg[:slowLogMaxArgLen] + "... (" + strconv.Itoa(len(arg)-slowLogMaxArgLen) + " more bytes)"
+		}
+		truncated = append(truncated, arg)
+	}
+
+	return truncated
+}
+
+// slowLogReply выполняет SLOWLOG GET [n], SLOWLOG LEN и SLOWLOG RESET.
+// Запись GET: номер, время начала в секундах Unix, длительность в микросекундах, команда с аргументами, адрес клиента
+func (db *DB) slowLogReply(args []string) Reply {
+	switch strings.ToUpper(args[0]) {
+	case SlowLogLen:
+		if db.slowLog == nil {
+			return intReply(0)
+		}
+		return intReply(int64(db.slowLog.Len()))
+	case SlowLogReset:
+		if db.slowLog != nil {
+			db.slowLog.Reset()
+		}
+		return okReply()
+	}
+
+	if db.slowLog == nil {
+		return arrayReply()
+	}
+
+	n := slowLogDefaultGet
+	if len(args) == 2 {
+		// число проверено при разборе команды
+		n, _ = strconv.Atoi(args[1])
+	}
+
+	entries := db.slowLog.Get(n)
+	items := make([]Reply, len(entries))
+	for i, entry := range entries {
+		items[i] = arrayReply(
+			intReply(entry.ID),
+			intReply(entry.Time.Unix()),
+			intReply(entry.Duration.Microseconds()),
+			listReply(append([]string{string(entry.Command)}, entry.Args...)),
+			stringReply(entry.Addr),
+		)
+	}
+
+	return arrayReply(items...)
+}
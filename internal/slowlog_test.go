@@ -0,0 +1,74 @@
+package internal_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+)
+
+func TestDB_SlowLog(t *testing.T) {
+	logger := zerolog.Nop()
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slowLog := internal.NewSlowQueryLog(internal.SlowLogConfig{Threshold: time.Nanosecond, MaxLen: 2}, logger)
+	db := internal.NewDB(internal.NewParser(logger), storage, logger, internal.WithSlowLog(slowLog))
+
+	session := internal.NewSession()
+	session.Addr = "127.0.0.1:5000"
+	ctx := internal.ContextWithSession(context.Background(), session)
+
+	long := strings.Repeat("x", 200)
+	for _, args := range [][]string{{"SET", "a", "1"}, {"SET", "b", long}} {
+		if _, err = db.QueryArgs(ctx, args); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reply, err := db.QueryArgs(ctx, []string{"SLOWLOG", "GET", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Array) != 1 {
+		t.Fatalf("expected 1 entry, got %v", reply)
+	}
+	entry := reply.Array[0].Array
+	if entry[0].Int != 1 || entry[4].Str != session.Addr {
+		t.Errorf("unexpected entry %v", entry)
+	}
+	args := entry[3].Array
+	if args[0].Str != "SET" || args[1].Str != "b" || args[2].Str != long[:128]+"... (72 more bytes)" {
+		t.Errorf("unexpected entry args %v", args)
+	}
+
+	// записей больше MaxLen не хранится
+	if reply, err = db.QueryArgs(ctx, []string{"SLOWLOG", "LEN"}); err != nil || reply.Int != 2 {
+		t.Fatalf("expected 2 entries, got %v %v", reply, err)
+	}
+
+	if _, err = db.QueryArgs(ctx, []string{"SLOWLOG", "RESET"}); err != nil {
+		t.Fatal(err)
+	}
+	// в журнал попадает сама команда RESET
+	if reply, err = db.QueryArgs(ctx, []string{"SLOWLOG", "LEN"}); err != nil || reply.Int != 1 {
+		t.Fatalf("expected 1 entry after reset, got %v %v", reply, err)
+	}
+
+	if _, err = db.QueryArgs(ctx, []string{"SLOWLOG", "GET", "-1"}); err == nil {
+		t.Error("expected negative count to be rejected")
+	}
+
+	// ожидание BLPOP не считается медленным запросом
+	if _, err = db.QueryArgs(ctx, []string{"BLPOP", "empty", "0.01"}); err == nil {
+		t.Error("expected BLPOP to time out")
+	}
+	if reply, err = db.QueryArgs(ctx, []string{"SLOWLOG", "LEN"}); err != nil || reply.Int != 2 {
+		t.Fatalf("expected BLPOP to be skipped, got %v %v", reply, err)
+	}
+}
@@ -4,53 +4,893 @@ import (
 	"context"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"strconv"
+	"sync"
+	"time"
 )
 
-var ErrNotFound = errors.New("key not found")
+var (
+	ErrNotFound  = errors.New("key not found")
+	ErrNotNumber = errors.New("value is not a number")
+	ErrWrongType = errors.New("WRONGTYPE operation against a key holding the wrong kind of value")
+	ErrTimeout   = errors.New("timeout")
+
+	// errNotApplied прерывает write без записи в журнал и событий, если команда ничего не изменила
+	errNotApplied = errors.New("not applied")
+)
 
 type iEngine interface {
 	Set(key string, value string)
-	Get(key string) (string, bool)
-	Del(key string)
+	Get(key string) (string, bool, error)
+	Del(key string) bool
+	Type(key string) ValueType
+	MGet(keys []string) ([]string, []bool)
+	MSet(pairs []string)
+	MDel(keys []string) int
+	IncrBy(key string, delta int64) (int64, error)
+	IncrByFloat(key string, delta float64) (float64, error)
+	HSet(key string, pairs []string) (int, error)
+	HGet(key string, field string) (string, bool, error)
+	HDel(key string, fields []string) (int, error)
+	HGetAll(key string) ([]string, error)
+	HKeys(key string) ([]string, error)
+	LPush(key string, values []string) (int, error)
+	RPush(key string, values []string) (int, error)
+	LPop(key string) (string, bool, error)
+	RPop(key string) (string, bool, error)
+	LRange(key string, start, stop int) ([]string, error)
+	LLen(key string) (int, error)
+	SAdd(key string, members []string) (int, error)
+	SRem(key string, members []string) (int, error)
+	SMembers(key string) ([]string, error)
+	SIsMember(key string, member string) (bool, error)
+	SInter(keys []string) ([]string, error)
+	SUnion(keys []string) ([]string, error)
+	ZAdd(key string, members []ScoredMember) (int, error)
+	ZRem(key string, members []string) (int, error)
+	ZRange(key string, start, stop int) ([]ScoredMember, error)
+	ZRangeByScore(key string, minScore, maxScore float64) ([]ScoredMember, error)
+	ZRank(key string, member string) (int, bool, error)
+	Keys(pattern string) []string
+	Scan(cursor string, pattern string, count int) (string, []string)
+	Len() int
+	Flush()
+	Exists(keys []string) int
+	Rename(src, dst string) error
+	Copy(src, dst string, replace bool) (bool, error)
+	SetIf(key string, value string, cond SetCondition) bool
+	Append(key string, value string) (int, error)
+	StrLen(key string) (int, error)
+	GetRange(key string, start, end int) (string, error)
+	SetRange(key string, offset int, value string) (int, error)
+	GetSet(key string, value string) (string, bool, error)
+	GetDel(key string) (string, bool, error)
+}
+
+type iWal interface {
+	Append(cmd Command) *Batch
+	Wait(ctx context.Context, batch *Batch) error
 }
 
 type Storage struct {
-	engine iEngine
+	// engines движки пространств ключей, создаются при первой записи
+	// и удаляются, когда в пространстве не остается ключей
+	engines    map[string]iEngine
+	enginesMtx sync.RWMutex
+	newEngine  func() iEngine
+	// empty пустой движок для чтения из несуществующих пространств ключей
+	empty iEngine
+
+	wal    iWal
 	logger zerolog.Logger
+
+	// writeMtx гарантирует, что порядок записей в журнале совпадает с порядком применения к движку
+	writeMtx sync.Mutex
+
+	// pushed будит ожидающих BLPOP при добавлении элементов в список
+	pushed *keyNotifier
+
+	// events публикует изменения ключей, nil если уведомления выключены
+	events *KeyspaceEvents
 }
 
-func NewStorage(engine iEngine, logger zerolog.Logger) *Storage {
+// NewStorage создает хранилище, newEngine создает движок для каждого пространства ключей,
+// wal может быть nil если журналирование выключено, events nil если уведомления выключены
+func NewStorage(newEngine func() iEngine, wal iWal, events *KeyspaceEvents, logger zerolog.Logger) *Storage {
 	return &Storage{
-		engine: engine,
-		logger: logger,
+		engines:    make(map[string]iEngine),
+		enginesMtx: sync.RWMutex{},
+		newEngine:  newEngine,
+		empty:      newEngine(),
+		wal:        wal,
+		logger:     logger,
+		writeMtx:   sync.Mutex{},
+		pushed:     newKeyNotifier(),
+		events:     events,
 	}
 }
 
-func NewStorageWithEngine(config EngineConfig, logger zerolog.Logger) (*Storage, error) {
-	engine, err := NewEngine(config.Type)
-	if err != nil {
+func NewStorageWithEngine(config EngineConfig, wal iWal, events *KeyspaceEvents, logger zerolog.Logger) (*Storage, error) {
+	if _, err := NewEngine(config.Type); err != nil {
 		return nil, err
 	}
 
-	return NewStorage(engine, logger), nil
+	newEngine := func() iEngine {
+		engine, _ := NewEngine(config.Type)
+		return engine
+	}
+
+	return NewStorage(newEngine, wal, events, logger), nil
 }
 
-func (s *Storage) Set(_ context.Context, key string, value string) error {
-	s.engine.Set(key, value)
+func (s *Storage) Set(ctx context.Context, key string, value string) error {
+	return s.write(ctx, func() (Command, error) {
+		s.engine(ctx).Set(key, value)
 
-	return nil
+		return Command{Type: Set, Args: []string{key, value}}, nil
+	})
+}
+
+// SetIf записывает значение при выполнении условия и возвращает была ли запись
+func (s *Storage) SetIf(ctx context.Context, key string, value string, cond SetCondition) (bool, error) {
+	var isSet bool
+	err := s.write(ctx, func() (Command, error) {
+		if isSet = s.engine(ctx).SetIf(key, value, cond); !isSet {
+			return Command{}, errNotApplied
+		}
+
+		return Command{Type: Set, Args: []string{key, value}}, nil
+	})
+
+	return isSet, err
+}
+
+// Append дописывает значение в конец строки и возвращает новую длину
+func (s *Storage) Append(ctx context.Context, key string, value string) (int, error) {
+	var length int
+	err := s.write(ctx, func() (Command, error) {
+		var err error
+		length, err = s.engine(ctx).Append(key, value)
+		if err != nil {
+			return Command{}, err
+		}
+
+		return Command{Type: Append, Args: []string{key, value}}, nil
+	})
+
+	return length, err
+}
+
+func (s *Storage) StrLen(ctx context.Context, key string) (int, error) {
+	return s.readEngine(ctx).StrLen(key)
+}
+
+func (s *Storage) GetRange(ctx context.Context, key string, start, end int) (string, error) {
+	return s.readEngine(ctx).GetRange(key, start, end)
+}
+
+// SetRange перезаписывает часть строки начиная с offset и возвращает новую длину
+func (s *Storage) SetRange(ctx context.Context, key string, offset int, value string) (int, error) {
+	var length int
+	err := s.write(ctx, func() (Command, error) {
+		var err error
+		length, err = s.engine(ctx).SetRange(key, offset, value)
+		if err != nil {
+			return Command{}, err
+		}
+		if value == "" {
+			return Command{}, errNotApplied
+		}
+
+		return Command{Type: SetRange, Args: []string{key, strconv.Itoa(offset), value}}, nil
+	})
+
+	return length, err
+}
+
+// GetSet записывает значение и возвращает предыдущее, в журнал пишется SET
+func (s *Storage) GetSet(ctx context.Context, key string, value string) (string, bool, error) {
+	var old string
+	var has bool
+	err := s.write(ctx, func() (Command, error) {
+		var err error
+		old, has, err = s.engine(ctx).GetSet(key, value)
+		if err != nil {
+			return Command{}, err
+		}
+
+		return Command{Type: Set, Args: []string{key, value}}, nil
+	})
+
+	return old, has, err
+}
+
+// GetDel удаляет ключ и возвращает его значение, в журнал пишется DEL
+func (s *Storage) GetDel(ctx context.Context, key string) (string, error) {
+	var val string
+	err := s.write(ctx, func() (Command, error) {
+		var has bool
+		var err error
+		val, has, err = s.engine(ctx).GetDel(key)
+		if err != nil {
+			return Command{}, err
+		}
+		if !has {
+			return Command{}, ErrNotFound
+		}
+
+		return Command{Type: Del, Args: []string{key}}, nil
+	})
+
+	return val, err
+}
+
+func (s *Storage) Get(ctx context.Context, key string) (string, error) {
+	val, has, err := s.readEngine(ctx).Get(key)
+	if err != nil {
+		return "", err
+	}
+	if !has {
+		return "", ErrNotFound
+	}
+	return val, nil
+}
+
+func (s *Storage) Del(ctx context.Context, key string) error {
+	return s.write(ctx, func() (Command, error) {
+		if !s.engine(ctx).Del(key) {
+			return Command{}, errNotApplied
+		}
+
+		return Command{Type: Del, Args: []string{key}}, nil
+	})
+}
+
+func (s *Storage) Type(ctx context.Context, key string) (ValueType, error) {
+	return s.readEngine(ctx).Type(key), nil
+}
+
+// MGet возвращает значения ключей в порядке запроса, для отсутствующих ключей has[i] == false
+func (s *Storage) MGet(ctx context.Context, keys []string) ([]string, []bool, error) {
+	values, has := s.readEngine(ctx).MGet(keys)
+
+	return values, has, nil
+}
+
+// MSet записывает все пары одной записью в журнале
+func (s *Storage) MSet(ctx context.Context, pairs []string) error {
+	return s.write(ctx, func() (Command, error) {
+		s.engine(ctx).MSet(pairs)
+
+		return Command{Type: MSet, Args: pairs}, nil
+	})
+}
+
+func (s *Storage) MDel(ctx context.Context, keys []string) (int, error) {
+	var deleted int
+	err := s.write(ctx, func() (Command, error) {
+		// в журнал и события попадают только удаленные ключи
+		engine := s.engine(ctx)
+		existing := make([]string, 0, len(keys))
+		seen := make(map[string]struct{}, len(keys))
+		for _, key := range keys {
+			if _, has := seen[key]; !has && engine.Exists([]string{key}) != 0 {
+				seen[key] = struct{}{}
+				existing = append(existing, key)
+			}
+		}
+		if len(existing) == 0 {
+			return Command{}, errNotApplied
+		}
+		deleted = engine.MDel(existing)
+
+		return Command{Type: MDel, Args: existing}, nil
+	})
+
+	return deleted, err
+}
+
+// IncrBy увеличивает целое значение ключа, в журнал пишется итоговый SET
+func (s *Storage) IncrBy(ctx context.Context, key string, delta int64) (int64, error) {
+	var result int64
+	err := s.write(ctx, func() (Command, error) {
+		var err error
+		result, err = s.engine(ctx).IncrBy(key, delta)
+		if err != nil {
+			return Command{}, err
+		}
+
+		return Command{Type: Set, Args: []string{key, strconv.FormatInt(result, 10)}}, nil
+	})
+
+	return result, err
+}
+
+// IncrByFloat увеличивает дробное значение ключа, в журнал пишется итоговый SET
+func (s *Storage) IncrByFloat(ctx context.Context, key string, delta float64) (float64, error) {
+	var result float64
+	err := s.write(ctx, func() (Command, error) {
+		var err error
+		result, err = s.engine(ctx).IncrByFloat(key, delta)
+		if err != nil {
+			return Command{}, err
+		}
+
+		return Command{Type: Set, Args: []string{key, FormatFloat(result)}}, nil
+	})
+
+	return result, err
+}
+
+// HSet записывает поля hash и возвращает количество новых полей
+func (s *Storage) HSet(ctx context.Context, key string, pairs []string) (int, error) {
+	var added int
+	err := s.write(ctx, func() (Command, error) {
+		var err error
+		added, err = s.engine(ctx).HSet(key, pairs)
+		if err != nil {
+			return Command{}, err
+		}
+
+		return Command{Type: HSet, Args: append([]string{key}, pairs...)}, nil
+	})
+
+	return added, err
 }
 
-func (s *Storage) Get(_ context.Context, key string) (string, error) {
-	val, has := s.engine.Get(key)
+func (s *Storage) HGet(ctx context.Context, key string, field string) (string, error) {
+	val, has, err := s.readEngine(ctx).HGet(key, field)
+	if err != nil {
+		return "", err
+	}
 	if !has {
 		return "", ErrNotFound
 	}
 	return val, nil
 }
 
-func (s *Storage) Del(_ context.Context, key string) error {
-	s.engine.Del(key)
+func (s *Storage) HDel(ctx context.Context, key string, fields []string) (int, error) {
+	var deleted int
+	err := s.write(ctx, func() (Command, error) {
+		var err error
+		deleted, err = s.engine(ctx).HDel(key, fields)
+		if err != nil {
+			return Command{}, err
+		}
+		if deleted == 0 {
+			return Command{}, errNotApplied
+		}
+
+		return Command{Type: HDel, Args: append([]string{key}, fields...)}, nil
+	})
+
+	return deleted, err
+}
+
+func (s *Storage) HGetAll(ctx context.Context, key string) ([]string, error) {
+	return s.readEngine(ctx).HGetAll(key)
+}
+
+func (s *Storage) HKeys(ctx context.Context, key string) ([]string, error) {
+	return s.readEngine(ctx).HKeys(key)
+}
+
+// LPush добавляет значения в начало списка и возвращает его длину
+func (s *Storage) LPush(ctx context.Context, key string, values []string) (int, error) {
+	return s.push(ctx, LPush, key, values, iEngine.LPush)
+}
+
+// RPush добавляет значения в конец списка и возвращает его длину
+func (s *Storage) RPush(ctx context.Context, key string, values []string) (int, error) {
+	return s.push(ctx, RPush, key, values, iEngine.RPush)
+}
+
+func (s *Storage) LPop(ctx context.Context, key string) (string, error) {
+	return s.pop(ctx, LPop, key, iEngine.LPop)
+}
+
+func (s *Storage) RPop(ctx context.Context, key string) (string, error) {
+	return s.pop(ctx, RPop, key, iEngine.RPop)
+}
+
+// BLPop ждет появления элемента в списке не дольше timeout, нулевой timeout ждет до отмены ctx
+// или отключения клиента
+func (s *Storage) BLPop(ctx context.Context, key string, timeout time.Duration) (string, error) {
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	// после отключения клиента элемент не забирается, иначе он будет потерян
+	var disconnected <-chan struct{}
+	if session := SessionFromContext(ctx); session != nil {
+		disconnected = session.Disconnected()
+	}
+
+	notifyKey := namespacedKey(namespaceFromContext(ctx), key)
+	for {
+		select {
+		case <-disconnected:
+			return "", context.Canceled
+		default:
+		}
+
+		pushed := s.pushed.wait(notifyKey)
+
+		val, err := s.LPop(ctx, key)
+		if !errors.Is(err, ErrNotFound) {
+			return val, err
+		}
+
+		select {
+		case <-pushed:
+		case <-timeoutCh:
+			return "", ErrTimeout
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-disconnected:
+			return "", context.Canceled
+		}
+	}
+}
+
+func (s *Storage) LRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	return s.readEngine(ctx).LRange(key, start, stop)
+}
+
+func (s *Storage) LLen(ctx context.Context, key string) (int, error) {
+	return s.readEngine(ctx).LLen(key)
+}
+
+// SAdd добавляет элементы в множество и возвращает количество новых
+func (s *Storage) SAdd(ctx context.Context, key string, members []string) (int, error) {
+	var added int
+	err := s.write(ctx, func() (Command, error) {
+		var err error
+		added, err = s.engine(ctx).SAdd(key, members)
+		if err != nil {
+			return Command{}, err
+		}
+		if added == 0 {
+			return Command{}, errNotApplied
+		}
+
+		return Command{Type: SAdd, Args: append([]string{key}, members...)}, nil
+	})
+
+	return added, err
+}
+
+func (s *Storage) SRem(ctx context.Context, key string, members []string) (int, error) {
+	var removed int
+	err := s.write(ctx, func() (Command, error) {
+		var err error
+		removed, err = s.engine(ctx).SRem(key, members)
+		if err != nil {
+			return Command{}, err
+		}
+		if removed == 0 {
+			return Command{}, errNotApplied
+		}
+
+		return Command{Type: SRem, Args: append([]string{key}, members...)}, nil
+	})
+
+	return removed, err
+}
+
+func (s *Storage) SMembers(ctx context.Context, key string) ([]string, error) {
+	return s.readEngine(ctx).SMembers(key)
+}
+
+func (s *Storage) SIsMember(ctx context.Context, key string, member string) (bool, error) {
+	return s.readEngine(ctx).SIsMember(key, member)
+}
+
+func (s *Storage) SInter(ctx context.Context, keys []string) ([]string, error) {
+	return s.readEngine(ctx).SInter(keys)
+}
+
+func (s *Storage) SUnion(ctx context.Context, keys []string) ([]string, error) {
+	return s.readEngine(ctx).SUnion(keys)
+}
+
+// ZAdd добавляет элементы в sorted set и возвращает количество новых
+func (s *Storage) ZAdd(ctx context.Context, key string, members []ScoredMember) (int, error) {
+	var added int
+	err := s.write(ctx, func() (Command, error) {
+		var err error
+		added, err = s.engine(ctx).ZAdd(key, members)
+		if err != nil {
+			return Command{}, err
+		}
+
+		args := make([]string, 0, 1+len(members)*2)
+		args = append(args, key)
+		for _, m := range members {
+			args = append(args, FormatFloat(m.Score), m.Member)
+		}
+
+		return Command{Type: ZAdd, Args: args}, nil
+	})
+
+	return added, err
+}
+
+func (s *Storage) ZRem(ctx context.Context, key string, members []string) (int, error) {
+	var removed int
+	err := s.write(ctx, func() (Command, error) {
+		var err error
+		removed, err = s.engine(ctx).ZRem(key, members)
+		if err != nil {
+			return Command{}, err
+		}
+		if removed == 0 {
+			return Command{}, errNotApplied
+		}
+
+		return Command{Type: ZRem, Args: append([]string{key}, members...)}, nil
+	})
+
+	return removed, err
+}
+
+func (s *Storage) ZRange(ctx context.Context, key string, start, stop int) ([]ScoredMember, error) {
+	return s.readEngine(ctx).ZRange(key, start, stop)
+}
+
+func (s *Storage) ZRangeByScore(ctx context.Context, key string, minScore, maxScore float64) ([]ScoredMember, error) {
+	return s.readEngine(ctx).ZRangeByScore(key, minScore, maxScore)
+}
+
+func (s *Storage) ZRank(ctx context.Context, key string, member string) (int, error) {
+	rank, has, err := s.readEngine(ctx).ZRank(key, member)
+	if err != nil {
+		return 0, err
+	}
+	if !has {
+		return 0, ErrNotFound
+	}
+	return rank, nil
+}
+
+// Keys возвращает все ключи подходящие под шаблон
+func (s *Storage) Keys(ctx context.Context, pattern string) ([]string, error) {
+	return s.readEngine(ctx).Keys(pattern), nil
+}
+
+// Scan возвращает следующую порцию ключей после cursor, пустой next означает конец обхода
+func (s *Storage) Scan(ctx context.Context, cursor string, pattern string, count int) (string, []string, error) {
+	next, keys := s.readEngine(ctx).Scan(cursor, pattern, count)
+
+	return next, keys, nil
+}
+
+// FlushDB удаляет все ключи текущего пространства ключей
+func (s *Storage) FlushDB(ctx context.Context) error {
+	return s.write(ctx, func() (Command, error) {
+		engine := s.engine(ctx)
+		if engine.Len() == 0 {
+			return Command{}, errNotApplied
+		}
+		engine.Flush()
+
+		return Command{Type: FlushDB}, nil
+	})
+}
+
+// FlushAll удаляет все ключи во всех пространствах ключей
+func (s *Storage) FlushAll(ctx context.Context) error {
+	return s.write(ctx, func() (Command, error) {
+		s.flushEngines()
+
+		return Command{Type: FlushAll}, nil
+	})
+}
+
+func (s *Storage) Exists(ctx context.Context, keys []string) (int, error) {
+	return s.readEngine(ctx).Exists(keys), nil
+}
+
+func (s *Storage) DBSize(ctx context.Context) (int, error) {
+	return s.readEngine(ctx).Len(), nil
+}
+
+// Rename атомарно переименовывает ключ, ErrNotFound если src нет
+func (s *Storage) Rename(ctx context.Context, src, dst string) error {
+	return s.write(ctx, func() (Command, error) {
+		if err := s.engine(ctx).Rename(src, dst); err != nil {
+			return Command{}, err
+		}
+		if src == dst {
+			return Command{}, errNotApplied
+		}
+
+		return Command{Type: Rename, Args: []string{src, dst}}, nil
+	})
+}
+
+// Copy копирует ключ и возвращает false если dst существует и replace не задан
+func (s *Storage) Copy(ctx context.Context, src, dst string, replace bool) (bool, error) {
+	var copied bool
+	err := s.write(ctx, func() (Command, error) {
+		var err error
+		copied, err = s.engine(ctx).Copy(src, dst, replace)
+		if err != nil {
+			return Command{}, err
+		}
+		if !copied {
+			return Command{}, errNotApplied
+		}
+
+		args := []string{src, dst}
+		if replace {
+			args = append(args, CopyReplace)
+		}
+
+		return Command{Type: Copy, Args: args}, nil
+	})
+
+	return copied, err
+}
+
+// NamespaceSizes возвращает количество ключей в DefaultNamespace и каждом непустом пространстве ключей
+func (s *Storage) NamespaceSizes(_ context.Context) (map[string]int, error) {
+	s.enginesMtx.RLock()
+	defer s.enginesMtx.RUnlock()
+
+	sizes := make(map[string]int, len(s.engines))
+	for namespace, engine := range s.engines {
+		sizes[namespace] = engine.Len()
+	}
+
+	return sizes, nil
+}
+
+func (s *Storage) flushEngines() {
+	s.enginesMtx.Lock()
+	defer s.enginesMtx.Unlock()
+
+	for namespace, engine := range s.engines {
+		engine.Flush()
+		if namespace != DefaultNamespace {
+			delete(s.engines, namespace)
+		}
+	}
+}
+
+// engine возвращает движок пространства ключей сессии из ctx для записи,
+// вызывается под writeMtx
+func (s *Storage) engine(ctx context.Context) iEngine {
+	return s.namespaceEngine(namespaceFromContext(ctx))
+}
+
+// readEngine возвращает движок пространства ключей сессии из ctx для чтения.
+// Чтение не создает движок, иначе SELECT с произвольными именами занимал бы память без ограничений
+func (s *Storage) readEngine(ctx context.Context) iEngine {
+	s.enginesMtx.RLock()
+	defer s.enginesMtx.RUnlock()
+
+	if engine, has := s.engines[namespaceFromContext(ctx)]; has {
+		return engine
+	}
+
+	return s.empty
+}
+
+// dropEmptyEngine удаляет движок пространства ключей без ключей, вызывается под writeMtx,
+// поэтому ни одна запись не держит удаляемый движок
+func (s *Storage) dropEmptyEngine(namespace string) {
+	if namespace == DefaultNamespace {
+		return
+	}
+
+	s.enginesMtx.Lock()
+	defer s.enginesMtx.Unlock()
+
+	if engine, has := s.engines[namespace]; has && engine.Len() == 0 {
+		delete(s.engines, namespace)
+	}
+}
+
+func (s *Storage) namespaceEngine(namespace string) iEngine {
+	s.enginesMtx.RLock()
+	engine, has := s.engines[namespace]
+	s.enginesMtx.RUnlock()
+	if has {
+		return engine
+	}
+
+	s.enginesMtx.Lock()
+	defer s.enginesMtx.Unlock()
+
+	if engine, has = s.engines[namespace]; !has {
+		engine = s.newEngine()
+		s.engines[namespace] = engine
+	}
+
+	return engine
+}
+
+// namespacedKey уникальный ключ в пределах всех пространств ключей
+func namespacedKey(namespace, key string) string {
+	return namespace + "\x00" + key
+}
+
+func (s *Storage) push(
+	ctx context.Context,
+	commandType CommandType,
+	key string,
+	values []string,
+	push func(iEngine, string, []string) (int, error),
+) (int, error) {
+	var length int
+	err := s.write(ctx, func() (Command, error) {
+		var err error
+		length, err = push(s.engine(ctx), key, values)
+		if err != nil {
+			return Command{}, err
+		}
+
+		return Command{Type: commandType, Args: append([]string{key}, values...)}, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.pushed.notify(namespacedKey(namespaceFromContext(ctx), key))
+
+	return length, nil
+}
+
+func (s *Storage) pop(
+	ctx context.Context,
+	commandType CommandType,
+	key string,
+	pop func(iEngine, string) (string, bool, error),
+) (string, error) {
+	var val string
+	var has bool
+	err := s.write(ctx, func() (Command, error) {
+		var err error
+		val, has, err = pop(s.engine(ctx), key)
+		if err != nil {
+			return Command{}, err
+		}
+		if !has {
+			return Command{}, ErrNotFound
+		}
+
+		return Command{Type: commandType, Args: []string{key}}, nil
+	})
+
+	return val, err
+}
+
+// Restore применяет запись журнала к движку без повторного журналирования
+func (s *Storage) Restore(cmd Command) error {
+	if err := cmd.validate(); err != nil {
+		return err
+	}
+
+	// записи, сделанные до появления пространств ключей, относятся к DefaultNamespace
+	namespace := cmd.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	engine := s.namespaceEngine(namespace)
+	defer s.dropEmptyEngine(namespace)
+
+	switch cmd.Type {
+	case Set:
+		engine.Set(cmd.Args[0], cmd.Args[1])
+	case Del:
+		engine.Del(cmd.Args[0])
+	case MSet:
+		engine.MSet(cmd.Args)
+	case MDel:
+		engine.MDel(cmd.Args)
+	case HSet:
+		_, err := engine.HSet(cmd.Args[0], cmd.Args[1:])
+		return err
+	case HDel:
+		_, err := engine.HDel(cmd.Args[0], cmd.Args[1:])
+		return err
+	case LPush:
+		_, err := engine.LPush(cmd.Args[0], cmd.Args[1:])
+		return err
+	case RPush:
+		_, err := engine.RPush(cmd.Args[0], cmd.Args[1:])
+		return err
+	case LPop:
+		_, _, err := engine.LPop(cmd.Args[0])
+		return err
+	case RPop:
+		_, _, err := engine.RPop(cmd.Args[0])
+		return err
+	case SAdd:
+		_, err := engine.SAdd(cmd.Args[0], cmd.Args[1:])
+		return err
+	case SRem:
+		_, err := engine.SRem(cmd.Args[0], cmd.Args[1:])
+		return err
+	case ZAdd:
+		members, err := parseScoredMembers(cmd.Args[1:])
+		if err != nil {
+			return err
+		}
+		_, err = engine.ZAdd(cmd.Args[0], members)
+		return err
+	case ZRem:
+		_, err := engine.ZRem(cmd.Args[0], cmd.Args[1:])
+		return err
+	case FlushDB:
+		engine.Flush()
+	case FlushAll:
+		s.flushEngines()
+	case Rename:
+		if err := engine.Rename(cmd.Args[0], cmd.Args[1]); err != nil {
+			return err
+		}
+	case Copy:
+		_, err := engine.Copy(cmd.Args[0], cmd.Args[1], len(cmd.Args) == 3)
+		return err
+	case Append:
+		_, err := engine.Append(cmd.Args[0], cmd.Args[1])
+		return err
+	case SetRange:
+		offset, err := strconv.Atoi(cmd.Args[1])
+		if err != nil {
+			return errors.Wrap(err, "invalid offset")
+		}
+		_, err = engine.SetRange(cmd.Args[0], offset, cmd.Args[2])
+		return err
+	default:
+		return errors.Errorf("unexpected wal record type %s", cmd.Type)
+	}
+
+	return nil
+}
+
+// write применяет изменение к движку и добавляет возвращенную запись в журнал
+// в одной критической секции, затем ждет записи журнала на диск.
+// Изменение видно другим клиентам до записи журнала. Если журнал записать не удалось,
+// клиент получает ошибку, но изменение остается в памяти до перезапуска сервера.
+// errNotApplied из apply означает, что ничего не изменилось: нет ни записи, ни событий
+func (s *Storage) write(ctx context.Context, apply func() (Command, error)) error {
+	s.writeMtx.Lock()
+	record, err := apply()
+	s.dropEmptyEngine(namespaceFromContext(ctx))
+	if errors.Is(err, errNotApplied) {
+		s.writeMtx.Unlock()
+		return nil
+	}
+	if err != nil {
+		s.writeMtx.Unlock()
+		return err
+	}
+	record.Namespace = namespaceFromContext(ctx)
+
+	// события публикуются под блокировкой, чтобы их порядок совпадал с порядком изменений
+	if s.events != nil {
+		s.events.publish(record)
+	}
+
+	var batch *Batch
+	if s.wal != nil {
+		batch = s.wal.Append(record)
+	}
+	s.writeMtx.Unlock()
+
+	if batch == nil {
+		return nil
+	}
+
+	if err = s.wal.Wait(ctx, batch); err != nil {
+		return errors.Wrap(err, "failed to write wal")
+	}
 
 	return nil
 }
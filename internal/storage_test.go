@@ -0,0 +1,155 @@
+package internal_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+)
+
+// failingWal журнал, запись в который всегда завершается ошибкой
+type failingWal struct{}
+
+func (failingWal) Append(internal.Command) *internal.Batch {
+	return internal.NewBatch(1)
+}
+
+func (failingWal) Wait(context.Context, *internal.Batch) error {
+	return errors.New("disk full")
+}
+
+func TestStorage_WalFailure(t *testing.T) {
+	logger := zerolog.Nop()
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, failingWal{}, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err = storage.Set(ctx, "a", "1"); err == nil {
+		t.Fatal("expected wal error")
+	}
+
+	// движок изменяется до записи журнала, поэтому значение остается в памяти
+	if val, err := storage.Get(ctx, "a"); err != nil || val != "1" {
+		t.Fatalf("expected value to stay in memory, got %q %v", val, err)
+	}
+}
+
+func TestStorage_IncrRestore(t *testing.T) {
+	logger := zerolog.Nop()
+	dir := t.TempDir()
+	walConfig := internal.WalConfig{
+		Enabled:      true,
+		BatchSize:    100,
+		BatchTimeout: time.Millisecond,
+		SegmentSize:  1024 * 1024,
+		DataDir:      dir,
+	}
+	wal, err := internal.NewWal(walConfig, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	walDone := make(chan struct{})
+	go func() {
+		defer close(walDone)
+		wal.Run(ctx)
+	}()
+
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, wal, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runQueries(t, internal.NewDB(internal.NewParser(logger), storage, logger), []queryCase{
+		{args: []string{"INCR", "n"}, expected: "1"},
+		{args: []string{"INCRBY", "n", "10"}, expected: "11"},
+		{args: []string{"DECR", "n"}, expected: "10"},
+		{args: []string{"INCRBY", "n", "-20"}, expected: "-10"},
+		{args: []string{"INCRBY", "n", "x"}, code: internal.CodeSyntax},
+		{args: []string{"INCRBYFLOAT", "f", "1.5"}, expected: "1.5"},
+		{args: []string{"INCRBYFLOAT", "f", "-0.25"}, expected: "1.25"},
+		{args: []string{"INCRBYFLOAT", "f", "x"}, code: internal.CodeSyntax},
+		{args: []string{"INCRBYFLOAT", "f", "inf"}, code: internal.CodeNotNumber},
+
+		{args: []string{"SET", "s", "abc"}, expected: "ok"},
+		{args: []string{"INCR", "s"}, code: internal.CodeNotNumber},
+		{args: []string{"INCRBYFLOAT", "s", "1"}, code: internal.CodeNotNumber},
+		{args: []string{"INCR", "f"}, code: internal.CodeNotNumber},
+
+		{args: []string{"SET", "max", "9223372036854775807"}, expected: "ok"},
+		{args: []string{"INCR", "max"}, code: internal.CodeNotNumber},
+		{args: []string{"SET", "min", "-9223372036854775808"}, expected: "ok"},
+		{args: []string{"DECR", "min"}, code: internal.CodeNotNumber},
+
+		{args: []string{"HSET", "h", "field", "1"}, expected: "1"},
+		{args: []string{"INCR", "h"}, code: internal.CodeWrongType},
+	})
+
+	cancel()
+	<-walDone
+	if err = wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// после перезапуска значения восстанавливаются из журнала
+	restored, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = internal.ReadSegments(dir, restored.Restore); err != nil {
+		t.Fatal(err)
+	}
+	runQueries(t, internal.NewDB(internal.NewParser(logger), restored, logger), []queryCase{
+		{args: []string{"GET", "n"}, expected: "-10"},
+		{args: []string{"GET", "f"}, expected: "1.25"},
+		{args: []string{"GET", "s"}, expected: "abc"},
+		{args: []string{"GET", "max"}, expected: "9223372036854775807"},
+	})
+}
+
+func TestStorage_NoOpWrites(t *testing.T) {
+	logger := zerolog.Nop()
+	broker, err := internal.NewBroker(internal.PubSubConfig{BufferSize: 16, SlowConsumer: internal.SlowConsumerDrop}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := internal.NewKeyspaceEvents(internal.NotificationsConfig{Events: []string{internal.EventsAll}}, broker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// любая запись в журнал вернула бы ошибку
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, failingWal{}, events, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subscriber := broker.NewSubscriber()
+	defer subscriber.Close()
+	subscriber.PSubscribe("*")
+
+	ctx := context.Background()
+	writes := map[string]func() error{
+		"DEL":      func() error { return storage.Del(ctx, "missing") },
+		"MDEL":     func() error { _, err := storage.MDel(ctx, []string{"missing", "other"}); return err },
+		"HDEL":     func() error { _, err := storage.HDel(ctx, "missing", []string{"f"}); return err },
+		"SREM":     func() error { _, err := storage.SRem(ctx, "missing", []string{"m"}); return err },
+		"ZREM":     func() error { _, err := storage.ZRem(ctx, "missing", []string{"m"}); return err },
+		"FLUSHDB":  func() error { return storage.FlushDB(ctx) },
+		"SET XX":   func() error { _, err := storage.SetIf(ctx, "missing", "v", internal.SetIfExists); return err },
+		"SETRANGE": func() error { _, err := storage.SetRange(ctx, "missing", 3, ""); return err },
+	}
+	for name, write := range writes {
+		if err := write(); err != nil {
+			t.Errorf("%s: expected no wal record, got %v", name, err)
+		}
+	}
+
+	if len(subscriber.Messages()) != 0 {
+		t.Errorf("unexpected event %+v", <-subscriber.Messages())
+	}
+}
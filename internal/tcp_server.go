@@ -3,11 +3,15 @@ package internal
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"io"
 	"log"
 	"net"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -17,161 +21,868 @@ import (
 const Delim = '\n'
 const DelimStr = string(Delim)
 
+// maxBinaryInFlight предельное число одновременно выполняемых запросов одного соединения
+const maxBinaryInFlight = 64
+
 type iDB interface {
 	Query(ctx context.Context, query string) (string, error)
 }
 
+type iServerDB interface {
+	iDB
+	QueryArgs(ctx context.Context, args []string) (Reply, error)
+}
+
 type ServerTCP struct {
 	cfg NetworkConfig
 
-	db iDB
+	db iServerDB
 
 	isRunning bool
 	logger    zerolog.Logger
 
-	connections    int
-	connectionsMtx sync.Mutex
+	// limiter ограничивает соединения основных слушателей, adminLimiter слушателя операторов
+	limiter      *connLimiter
+	adminLimiter *connLimiter
+
+	// stopping закрывается при остановке сервера: соединения дописывают ответы
+	// на выполняемые запросы и закрываются, не читая новых
+	stopping chan struct{}
+	handlers sync.WaitGroup
+
+	// stats счетчики, общие с HTTP шлюзом и INFO
+	stats *ServerCounters
+
+	// userLimits ограничения частоты запросов пользователей, общие для их соединений
+	userLimits *UserRateLimits
+}
+
+// ServerStats счетчики сервера с момента запуска
+type ServerStats struct {
+	Connections int64
+	Rejected    int64
+	// Queued соединения, ждавшие освобождения места
+	Queued  int64
+	Queries int64
+	// RateLimited запросы, отклоненные ограничением частоты, Delayed задержанные им
+	RateLimited int64
+	Delayed     int64
+}
+
+// ServerCounters счетчики соединений и запросов, общие для TCP-сервера, HTTP шлюза и INFO
+type ServerCounters struct {
+	connections atomic.Int64
+	rejected    atomic.Int64
+	queued      atomic.Int64
+	queries     atomic.Int64
+	rateLimited atomic.Int64
+	delayed     atomic.Int64
+}
+
+func NewServerCounters() *ServerCounters {
+	return &ServerCounters{}
 }
 
-func NewServerTCP(config NetworkConfig, db iDB, logger zerolog.Logger) *ServerTCP {
+// Stats возвращает текущие значения счетчиков
+func (c *ServerCounters) Stats() ServerStats {
+	return ServerStats{
+		Connections: c.connections.Load(),
+		Rejected:    c.rejected.Load(),
+		Queued:      c.queued.Load(),
+		Queries:     c.queries.Load(),
+		RateLimited: c.rateLimited.Load(),
+		Delayed:     c.delayed.Load(),
+	}
+}
+
+func NewServerTCP(config NetworkConfig, db iServerDB, logger zerolog.Logger, opts ...ServerOption) *ServerTCP {
+	options := newServerOptions(config.RateLimit, opts)
 	return &ServerTCP{
-		cfg:            config,
-		db:             db,
-		isRunning:      false,
-		logger:         logger,
-		connections:    0,
-		connectionsMtx: sync.Mutex{},
+		cfg:          config,
+		db:           db,
+		isRunning:    false,
+		logger:       logger,
+		limiter:      newConnLimiter(config.MaxConnections, config.AcceptQueue, config.AcceptTimeout),
+		adminLimiter: newConnLimiter(config.Admin.MaxConnections, 0, 0),
+		stopping:     make(chan struct{}),
+		stats:        options.stats,
+		userLimits:   options.userLimits,
 	}
 }
 
+func (t *ServerTCP) Stats() ServerStats {
+	return t.stats.Stats()
+}
+
+// Run принимает соединения до отмены ctx. После отмены слушатель закрывается,
+// выполняемые запросы завершаются в пределах DrainTimeout, затем прерываются
 func (t *ServerTCP) Run(ctx context.Context) error {
 	if t.isRunning {
 		return errors.New("already running")
 	}
 
+	if err := t.cfg.RateLimit.validate(); err != nil {
+		return err
+	}
+
 	t.isRunning = true
-	listener, err := net.ListenTCP("tcp", &t.cfg.Address)
+	listeners, err := t.listen()
 	if err != nil {
 		return err
 	}
 
-	defer func() {
-		err := listener.Close()
-		if err != nil {
-			t.logger.Error().Err(err).Msg("error closing listener")
-		} else {
-			t.logger.Info().Msg("tcp listener closed")
+	// запросы не должны прерываться сразу при остановке, их контекст отменяется после DrainTimeout
+	queryCtx, cancelQueries := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelQueries()
+
+	// Accept не следит за контекстом, поэтому остановка закрывает слушатели
+	go func() {
+		<-ctx.Done()
+		close(t.stopping)
+
+		for _, listener := range listeners {
+			err := listener.Close()
+			if err != nil {
+				t.logger.Error().Err(err).Msgf("error closing %s listener", listener.Addr().Network())
+			} else {
+				t.logger.Info().Msgf("%s listener closed", listener.Addr().Network())
+			}
 		}
 	}()
 
-	t.logger.Info().Msg("listening on tcp://" + t.cfg.Address.String())
+	var accepting sync.WaitGroup
+	for _, listener := range listeners {
+		accepting.Add(1)
+		go func() {
+			defer accepting.Done()
+			t.accept(queryCtx, listener.Listener, listener.limiter)
+		}()
+	}
+	accepting.Wait()
 
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
+	return t.drain(cancelQueries)
+}
+
+// serverListener слушатель и семафор, ограничивающий его соединения
+type serverListener struct {
+	net.Listener
+	limiter *connLimiter
+}
+
+// listen открывает TCP-слушатель, Unix-сокет и слушатель операторов согласно конфигурации
+func (t *ServerTCP) listen() ([]serverListener, error) {
+	var listeners []serverListener
+	closeAll := func() {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+	}
+
+	if !t.cfg.DisableTCP {
+		listener, err := t.listenTCP(t.cfg.Address.String())
+		if err != nil {
+			return nil, err
+		}
+
+		listeners = append(listeners, serverListener{Listener: listener, limiter: t.limiter})
+	}
+
+	// сокет доступен только локально, доступ к нему ограничивают права на файл, поэтому он без TLS
+	if t.cfg.UnixSocket.Enabled() {
+		listener, err := ListenUnix(t.cfg.UnixSocket)
+		if err != nil {
+			closeAll()
+			return nil, errors.Wrap(err, "failed to listen on unix socket")
+		}
+
+		t.logger.Info().Msg("listening on " + UnixScheme + t.cfg.UnixSocket.Path)
+		listeners = append(listeners, serverListener{Listener: listener, limiter: t.limiter})
+	}
+
+	if len(listeners) == 0 {
+		return nil, errors.New("tcp is disabled and unix socket is not configured")
+	}
+
+	if t.cfg.Admin.Enabled() {
+		listener, err := t.listenTCP(t.cfg.Admin.Address)
+		if err != nil {
+			closeAll()
+			return nil, errors.Wrap(err, "failed to listen on admin address")
 		}
+
+		t.logger.Info().Msgf("admin connections limited to %d", t.cfg.Admin.MaxConnections)
+		listeners = append(listeners, serverListener{Listener: listener, limiter: t.adminLimiter})
+	}
+
+	return listeners, nil
+}
+
+// listenTCP слушает TCP-адрес, с TLS если он включен
+func (t *ServerTCP) listenTCP(address string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.cfg.TLS.Enabled() {
+		tlsConfig, err := NewServerTLSConfig(t.cfg.TLS)
+		if err != nil {
+			_ = listener.Close()
+			return nil, errors.Wrap(err, "failed to configure tls")
+		}
+
+		listener = tls.NewListener(listener, tlsConfig)
+		t.logger.Info().Msgf("tls enabled, client certificates required: %t", tlsConfig.ClientCAs != nil)
+	}
+
+	t.logger.Info().Msg("listening on tcp://" + address)
+
+	return listener, nil
+}
+
+// accept принимает соединения, пока слушатель не закрыт
+func (t *ServerTCP) accept(ctx context.Context, listener net.Listener, limiter *connLimiter) {
+	for {
 		// Принимаем входящее соединение
 		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
 		if err != nil {
 			log.Println("Ошибка при принятии соединения:", err)
 			continue
 		}
 
 		// Обрабатываем соединение в отдельной горутине
-		go t.handleConnection(ctx, conn)
+		t.handlers.Add(1)
+		go func() {
+			defer t.handlers.Done()
+			t.handleConnection(ctx, conn, limiter)
+		}()
 	}
 }
 
-func (t *ServerTCP) handleConnection(ctx context.Context, conn net.Conn) {
-	t.connectionsMtx.Lock()
-	if t.connections+1 > t.cfg.MaxConnections {
+// drain ждет закрытия соединений, по истечении DrainTimeout прерывает их запросы
+func (t *ServerTCP) drain(cancelQueries context.CancelFunc) error {
+	t.logger.Info().Msgf("draining %d connections", t.activeConnections())
+
+	drained := make(chan struct{})
+	go func() {
+		t.handlers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		t.logger.Info().Msg("all connections drained")
+		return nil
+	case <-time.After(t.cfg.DrainTimeout):
+	}
+
+	active := t.activeConnections()
+	cancelQueries()
+	<-drained
+
+	return errors.Errorf("drain timeout %s exceeded, %d connections interrupted", t.cfg.DrainTimeout, active)
+}
+
+func (t *ServerTCP) handleConnection(ctx context.Context, conn net.Conn, limiter *connLimiter) {
+	// ожидающий место клиент может уже присылать запросы, они копятся в буфере сокета
+	ok, queued := limiter.acquire(t.stopping)
+	if queued {
+		t.stats.queued.Add(1)
+	}
+	if !ok {
 		t.handleConnectionLimit(conn)
-		t.connectionsMtx.Unlock()
+		t.stats.rejected.Add(1)
 		return
 	}
-	t.connections++
-	t.connectionsMtx.Unlock()
-	defer t.closeConnection(conn)
+	t.stats.connections.Add(1)
+	defer t.closeConnection(conn, limiter)
 
 	t.logger.Info().Msgf("%s connected", conn.RemoteAddr())
 	defer t.logger.Info().Msgf("%s diconnected", conn.RemoteAddr())
 
+	session := NewSession()
+	session.Addr = conn.RemoteAddr().String()
+	if conn.LocalAddr().Network() == "unix" {
+		// у клиентов Unix-сокета нет своего адреса, их различает uid процесса: неудачные попытки AUTH
+		// одного пользователя системы не блокируют других, а переподключение не снимает блокировку
+		session.Addr = UnixScheme + t.cfg.UnixSocket.Path
+		if peer := unixPeer(conn); peer != "" {
+			session.Addr += "#" + peer
+		}
+	}
+	ctx = ContextWithSession(ctx, session)
+	defer session.Close()
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if !t.handshake(ctx, tlsConn, session) {
+			return
+		}
+	}
+
 	// Чтение данных от клиента
 	reader := bufio.NewReader(conn)
+
+	// клиенты Redis начинают каждую команду с массива RESP,
+	// запросы текстового протокола с него начинаться не могут
+	var first []byte
+	var err error
+	if !t.read(ctx, conn, func() { first, err = reader.Peek(1) }) {
+		return
+	}
+	limits := newRateLimiter(t.cfg.RateLimit, t.userLimits)
+	if err == nil && first[0] == respArray {
+		t.logger.Debug().Msgf("%s uses resp", conn.RemoteAddr())
+		t.handleRESP(ctx, conn, reader, limits)
+		return
+	}
+	if err == nil && first[0] == BinaryMagic[0] {
+		t.logger.Debug().Msgf("%s uses binary protocol", conn.RemoteAddr())
+		t.handleBinary(ctx, conn, reader, limits)
+		return
+	}
+
+	t.handleLines(ctx, conn, reader, limits)
+}
+
+// handshake выполняет рукопожатие TLS и запоминает пользователя из сертификата клиента
+func (t *ServerTCP) handshake(ctx context.Context, conn *tls.Conn, session *Session) bool {
+	if err := conn.SetDeadline(t.idleDeadline()); err != nil {
+		t.logger.Error().Err(err).Msg("error setting deadline")
+		return false
+	}
+
+	if err := conn.HandshakeContext(ctx); err != nil {
+		t.logger.Error().Err(err).Msgf("tls handshake with %s failed", conn.RemoteAddr())
+		return false
+	}
+
+	if user := certificateIdentity(conn.ConnectionState()); user != "" {
+		session.SetUser(user)
+		t.logger.Info().Msgf("%s identified by certificate as %s", conn.RemoteAddr(), user)
+	}
+
+	return true
+}
+
+// handleLines обслуживает соединение по текстовому протоколу, запрос на строку
+func (t *ServerTCP) handleLines(ctx context.Context, conn net.Conn, reader *bufio.Reader, limits *rateLimiter) {
+	SessionFromContext(ctx).AllowPush()
+	writer := bufio.NewWriter(t.connWriter(conn))
+	servePipeline(ctx, t, conn, writer,
+		func() (string, error) {
+			return ReadLine(reader, t.cfg.MaxMessageSize)
+		},
+		func(message string, err error) bool {
+			if errors.Is(err, ErrMessageTooLarge) {
+				// остаток запроса не прочитан, поэтому соединение закрывается
+				t.logger.Error().Err(err).Msgf("closing %s", conn.RemoteAddr())
+				_, _ = writer.WriteString(EncodeResponse("", err) + DelimStr)
+				return false
+			}
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					t.logger.Info().Msgf("client %s disconnected", conn.RemoteAddr())
+				} else {
+					t.logger.Error().Err(err).Msg("error reading from tcp connection")
+				}
+				return false
+			}
+
+			// Убираем лишние пробелы и символы новой строки
+			message = strings.TrimSpace(message)
+			t.logger.Debug().Msgf("received message from %s: %s", conn.RemoteAddr(), redactQuery(message))
+
+			if err = t.limit(ctx, limits, len(message)); err != nil {
+				if !errors.Is(err, ErrRateLimited) {
+					return false
+				}
+				_, err = writer.WriteString(EncodeResponse("", err) + DelimStr)
+				return err == nil
+			}
+
+			// exec query
+			t.stats.queries.Add(1)
+			response, err := t.db.Query(ctx, message)
+			if err != nil {
+				t.logger.Error().Err(err).Msgf("error executing query %s", redactQuery(message))
+			} else if response == "" {
+				response = "ok"
+			}
+
+			response = EncodeResponse(response, err) + DelimStr
+			t.logger.Debug().Msgf("writing response '%s' to %s", response, conn.RemoteAddr())
+
+			if _, err = writer.WriteString(response); err != nil {
+				t.logger.Err(err).Msg("on send response")
+				return false
+			}
+
+			return true
+		},
+		func(message Message) bool {
+			_, err := writer.WriteString(EncodeResponse(message.Reply().String(), nil) + DelimStr)
+			return err == nil
+		})
+}
+
+// handleRESP обслуживает соединение по протоколу RESP
+func (t *ServerTCP) handleRESP(ctx context.Context, conn net.Conn, reader *bufio.Reader, limits *rateLimiter) {
+	SessionFromContext(ctx).AllowPush()
+	writer := bufio.NewWriter(t.connWriter(conn))
+	version := RESP2
+	servePipeline(ctx, t, conn, writer,
+		func() ([]string, error) {
+			return ReadRESPCommand(reader, t.cfg.MaxMessageSize)
+		},
+		func(args []string, err error) bool {
+			if errors.Is(err, ErrProtocol) || errors.Is(err, ErrMessageTooLarge) {
+				// после ошибки разбора нельзя найти начало следующей команды
+				WriteRESPError(writer, err)
+				return false
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					t.logger.Error().Err(err).Msg("error reading from tcp connection")
+				}
+				return false
+			}
+			if len(args) == 0 {
+				return true
+			}
+
+			t.logger.Debug().Msgf("received resp command from %s: %q", conn.RemoteAddr(), redactArgs(args))
+
+			if err = t.limit(ctx, limits, argsSize(args)); err != nil {
+				if !errors.Is(err, ErrRateLimited) {
+					return false
+				}
+				WriteRESPError(writer, err)
+				return true
+			}
+
+			t.stats.queries.Add(1)
+			reply, err := t.queryRESP(ctx, args, &version)
+			if err != nil {
+				t.logger.Error().Err(err).Msgf("error executing query %q", redactArgs(args))
+				WriteRESPError(writer, err)
+			} else if err = WriteRESPReply(writer, reply, version); err != nil {
+				t.logger.Err(err).Msg("on encode response")
+				return false
+			}
+
+			return true
+		},
+		func(message Message) bool {
+			return WriteRESPReply(writer, message.Reply(), version) == nil
+		})
+}
+
+// argsSize размер команды в байтах без учета кодирования протокола
+func argsSize(args []string) int {
+	size := 0
+	for _, arg := range args {
+		size += len(arg)
+	}
+
+	return size
+}
+
+// pipelineQueueSize предельное число запросов одного соединения, прочитанных заранее
+const pipelineQueueSize = 128
+
+type pipelined[T any] struct {
+	request T
+	err     error
+}
+
+// servePipeline читает запросы соединения в отдельной горутине, пока выполняются предыдущие,
+// и передает их в handle по порядку вместе с ошибкой чтения, после которой чтение прекращается.
+// Сообщения каналов, на которые подписано соединение, передаются в push между запросами.
+// Ответы копятся в writer и отправляются, когда прочитанные запросы и сообщения закончились.
+// handle и push возвращают false, если соединение нужно закрыть
+func servePipeline[T any](ctx context.Context, t *ServerTCP, conn net.Conn, writer *bufio.Writer,
+	read func() (T, error), handle func(T, error) bool, push func(Message) bool,
+) {
+	// пока выполняются блокирующие команды (BLPOP), клиент может ничего не присылать,
+	// поэтому простой отсчитывается ниже только при пустой очереди
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		t.logger.Error().Err(err).Msg("error setting deadline")
+		return
+	}
+
+	session := SessionFromContext(ctx)
+	queue := make(chan pipelined[T], pipelineQueueSize)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			request, err := read()
+			if err != nil {
+				// клиент отключился: ожидающий BLPOP не должен забрать элемент из списка
+				session.Disconnect()
+			}
+			select {
+			case queue <- pipelined[T]{request: request, err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var idle <-chan time.Time
+	var idleTimer *time.Timer
+	if t.cfg.IdleTimeout > 0 {
+		idleTimer = time.NewTimer(t.cfg.IdleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+
 	for {
-		done := make(chan struct{})
-		var message string
-		var err error
-		go func() {
-			defer close(done)
-			message, err = reader.ReadString(Delim)
-		}()
+		// подписанный клиент может только слушать, поэтому простой не отсчитывается
+		waitIdle := idle
+		var messages <-chan Message
+		var slow <-chan struct{}
+		if subscriber := session.Subscriber(); subscriber != nil {
+			messages = subscriber.Messages()
+			slow = subscriber.Done()
+			if subscriber.Count() > 0 {
+				waitIdle = nil
+			}
+		}
 
+		var p pipelined[T]
+		var message Message
+		pushed := false
 		select {
 		case <-ctx.Done():
 			return
-		case <-done:
-			if err = conn.SetDeadline(time.Now().Add(t.cfg.IdleTimeout)); err != nil {
-				t.logger.Error().Err(err).Msg("error setting deadline")
-				return
+		case <-t.stopping:
+			// ответы на уже выполненные запросы могли остаться в буфере
+			_ = writer.Flush()
+			return
+		case <-waitIdle:
+			t.logger.Info().Msgf("%s idle timeout", conn.RemoteAddr())
+			return
+		case <-slow:
+			t.logger.Warn().Msgf("%s disconnected as slow consumer", conn.RemoteAddr())
+			return
+		case message = <-messages:
+			pushed = true
+		case p = <-queue:
+		}
+
+		if pushed && !push(message) || !pushed && !handle(p.request, p.err) {
+			_ = writer.Flush()
+			return
+		}
+
+		if len(queue) > 0 || len(messages) > 0 {
+			continue
+		}
+		if err := writer.Flush(); err != nil {
+			t.logger.Err(err).Msg("on send response")
+			return
+		}
+		t.logger.Debug().Msgf("wrote responses to %s", conn.RemoteAddr())
+
+		if idleTimer != nil && !pushed {
+			idleTimer.Reset(t.cfg.IdleTimeout)
+		}
+	}
+}
+
+// connWriter продлевает дедлайн записи перед каждой отправкой:
+// блокирующие команды (BLPOP) могут ждать дольше idle timeout
+func (t *ServerTCP) connWriter(conn net.Conn) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		if err := conn.SetWriteDeadline(t.idleDeadline()); err != nil {
+			return 0, err
+		}
+
+		return conn.Write(p)
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// idleDeadline дедлайн операции с соединением, нулевой idle timeout его не ограничивает
+func (t *ServerTCP) idleDeadline() time.Time {
+	if t.cfg.IdleTimeout <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(t.cfg.IdleTimeout)
+}
+
+// queryRESP выполняет команду RESP. HELLO меняет версию протокола соединения,
+// отсутствующее значение и истекший таймаут читающих команд возвращаются как nil, как это делает Redis
+func (t *ServerTCP) queryRESP(ctx context.Context, args []string, version *int) (Reply, error) {
+	if strings.EqualFold(args[0], respHello) {
+		if len(args) > 1 {
+			v, err := strconv.Atoi(args[1])
+			if err != nil || (v != RESP2 && v != RESP3) {
+				return Reply{}, errors.Wrapf(ErrInvalidCommand, "unsupported protocol version %s", args[1])
 			}
+			*version = v
+		}
+
+		return mapReply([]string{"server", "key-value-storage", "proto", strconv.Itoa(*version)}), nil
+	}
+
+	reply, err := t.db.QueryArgs(ctx, args)
+	if (errors.Is(err, ErrNotFound) || errors.Is(err, ErrTimeout)) && repliesNilOnMiss(args[0]) {
+		return nilReply(), nil
+	}
+
+	return reply, err
+}
+
+// handleBinary обслуживает соединение по двоичному протоколу.
+// Читающие запросы выполняются параллельно, не больше maxBinaryInFlight одновременно,
+// остальные ждут завершения предыдущих и задерживают последующие, поэтому
+// порядок изменений и команд сессии (SELECT, AUTH) сохраняется.
+// Ответы отправляются по мере готовности с request id запроса
+func (t *ServerTCP) handleBinary(ctx context.Context, conn net.Conn, reader *bufio.Reader, limits *rateLimiter) {
+	var clientVersion byte
+	var err error
+	if !t.read(ctx, conn, func() { clientVersion, err = ReadHandshake(reader) }) {
+		return
+	}
+	if err != nil {
+		t.logger.Error().Err(err).Msgf("bad handshake from %s", conn.RemoteAddr())
+		return
+	}
+
+	version := min(clientVersion, BinaryVersion)
+	if err = WriteHandshake(conn, version); err != nil {
+		t.logger.Err(err).Msg("on send handshake")
+		return
+	}
+
+	var writeMtx sync.Mutex
+	write := func(frame Frame) error {
+		writeMtx.Lock()
+		defer writeMtx.Unlock()
+
+		// блокирующие команды (BLPOP) могут ждать дольше idle timeout
+		if err := conn.SetWriteDeadline(t.idleDeadline()); err != nil {
+			return err
 		}
 
+		return WriteFrame(conn, frame)
+	}
+	writeErr := func(requestID uint32, err error) error {
+		return write(Frame{
+			Version:   version,
+			Opcode:    OpError,
+			RequestID: requestID,
+			Payload:   []byte(EncodeResponse("", err)),
+		})
+	}
+
+	inFlight := make(chan struct{}, maxBinaryInFlight)
+	wg := sync.WaitGroup{}
+
+	// barrier завершается вместе с последним упорядоченным запросом,
+	// readers завершаются вместе с читающими запросами, полученными после него
+	barrier := make(chan struct{})
+	close(barrier)
+	var readers []chan struct{}
+
+	// при закрытии соединения клиентом прерываем ожидающие запросы (BLPOP),
+	// при остановке сервера даем им завершиться
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		select {
+		case <-t.stopping:
+		default:
+			cancel()
+		}
+		wg.Wait()
+		cancel()
+	}()
+
+	for {
+		var frame Frame
+		if !t.read(ctx, conn, func() { frame, err = ReadFrame(reader, t.cfg.MaxMessageSize) }) {
+			return
+		}
+		if errors.Is(err, ErrMessageTooLarge) {
+			// payload не прочитан, поэтому начало следующего кадра потеряно
+			t.logger.Error().Err(err).Msgf("closing %s", conn.RemoteAddr())
+			_ = writeErr(frame.RequestID, err)
+			return
+		}
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				t.logger.Info().Msgf("client %s disconnected", conn.RemoteAddr())
-				return
+			if !errors.Is(err, io.EOF) {
+				t.logger.Error().Err(err).Msg("error reading from tcp connection")
 			}
+			return
+		}
 
-			t.logger.Error().Err(err).Msg("error reading from tcp connection")
-			time.Sleep(100 * time.Millisecond)
+		if frame.Version != version || frame.Opcode != OpQuery {
+			err = errors.Wrapf(ErrProtocol, "unexpected frame version %d opcode %d", frame.Version, frame.Opcode)
+			if err = writeErr(frame.RequestID, err); err != nil {
+				t.logger.Err(err).Msg("on send response")
+				return
+			}
 			continue
 		}
 
-		// Убираем лишние пробелы и символы новой строки
-		message = strings.TrimSpace(message)
-		t.logger.Debug().Msgf("received message from %s: %s", conn.RemoteAddr(), message)
+		if err = t.limit(ctx, limits, len(frame.Payload)); err != nil {
+			if !errors.Is(err, ErrRateLimited) {
+				return
+			}
+			if err = writeErr(frame.RequestID, err); err != nil {
+				t.logger.Err(err).Msg("on send response")
+				return
+			}
+			continue
+		}
 
-		// exec query
-		response, err := t.db.Query(ctx, message)
+		args, err := DecodeArgs(frame.Payload)
 		if err != nil {
-			response = err.Error()
-			t.logger.Error().Err(err).Msgf("error executing query %s", message)
-		} else if response == "" {
-			response = "ok"
+			if err = writeErr(frame.RequestID, err); err != nil {
+				t.logger.Err(err).Msg("on send response")
+				return
+			}
+			continue
 		}
 
-		response += DelimStr
-		t.logger.Debug().Msgf("writing response '%s' to %s", response, conn.RemoteAddr())
-
-		// Отправляем ответ клиенту
-		_, err = conn.Write([]byte(response))
-		if err != nil {
-			t.logger.Err(err).Msg("on send response")
+		select {
+		case inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return
+		case <-t.stopping:
 			return
 		}
 
-		t.logger.Debug().Msgf("wrote response to %s", conn.RemoteAddr())
+		done := make(chan struct{})
+		wait := []chan struct{}{barrier}
+		if len(args) > 0 && isConcurrent(args[0]) {
+			// завершенные запросы ждать не нужно
+			readers = slices.DeleteFunc(readers, func(ch chan struct{}) bool {
+				select {
+				case <-ch:
+					return true
+				default:
+					return false
+				}
+			})
+			readers = append(readers, done)
+		} else {
+			wait = append(wait, readers...)
+			barrier, readers = done, nil
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			defer close(done)
+
+			for _, ch := range wait {
+				select {
+				case <-ch:
+				case <-ctx.Done():
+					// клиент отключился, оставшиеся запросы не выполняются
+					return
+				}
+			}
+
+			t.stats.queries.Add(1)
+			reply, err := t.db.QueryArgs(ctx, args)
+			if err != nil {
+				t.logger.Error().Err(err).Msgf("error executing request %d", frame.RequestID)
+				err = writeErr(frame.RequestID, err)
+			} else {
+				err = write(Frame{Version: version, Opcode: OpReply, RequestID: frame.RequestID, Payload: EncodeReply(reply)})
+			}
+			if err != nil {
+				t.logger.Err(err).Msg("on send response")
+			}
+		}()
+	}
+}
+
+// read выполняет чтение из соединения и прерывает ожидание при отмене контекста,
+// после чтения продлевает idle timeout. Возвращает false, если соединение нужно закрыть
+func (t *ServerTCP) read(ctx context.Context, conn net.Conn, read func()) bool {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		read()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.stopping:
+		return false
+	case <-done:
 	}
+
+	if err := conn.SetDeadline(t.idleDeadline()); err != nil {
+		t.logger.Error().Err(err).Msg("error setting deadline")
+		return false
+	}
+
+	return true
 }
 
 func (t *ServerTCP) handleConnectionLimit(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
 	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
 		t.logger.Error().Msgf("on set dedline for %s", conn.RemoteAddr())
 		return
 	}
 
-	if _, err := conn.Write([]byte("too many connections" + DelimStr)); err != nil {
+	response := EncodeResponse("", ErrTooManyConnections) + DelimStr
+	if _, err := conn.Write([]byte(response)); err != nil {
 		t.logger.Error().Msgf("on send too many connections for %s", conn.RemoteAddr())
 	}
 }
 
-func (t *ServerTCP) closeConnection(conn net.Conn) {
-	t.connectionsMtx.Lock()
-	t.connections--
-	t.connectionsMtx.Unlock()
+// ReadLine читает строку вместе с Delim. Строка длиннее maxSize байт без учета Delim
+// отклоняется с ErrMessageTooLarge, не накапливая ее в памяти. maxSize <= 0 снимает ограничение
+func ReadLine(r *bufio.Reader, maxSize int) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice(Delim)
+
+		size := len(line) + len(chunk)
+		if err == nil {
+			size--
+		}
+		if maxSize > 0 && size > maxSize {
+			return "", errors.Wrapf(ErrMessageTooLarge, "message exceeds %d bytes", maxSize)
+		}
+
+		line = append(line, chunk...)
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return string(line), err
+		}
+	}
+}
+
+// activeConnections возвращает число обслуживаемых соединений всех слушателей
+func (t *ServerTCP) activeConnections() int {
+	return t.limiter.active() + t.adminLimiter.active()
+}
+
+func (t *ServerTCP) closeConnection(conn net.Conn, limiter *connLimiter) {
+	defer limiter.release()
 
 	err := conn.Close()
 	if err != nil {
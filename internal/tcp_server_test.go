@@ -0,0 +1,332 @@
+package internal_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+	"key-value-storage/internal/client"
+)
+
+// mixedPipeline возвращает запросы разных типов, ответы на которые зависят от порядка выполнения
+func mixedPipeline(n int) (queries [][]string, expected []string) {
+	for i := range n {
+		key := "key" + strconv.Itoa(i)
+		queries = append(queries,
+			[]string{"SET", key, strconv.Itoa(i)},
+			[]string{"INCR", "counter"},
+			[]string{"GET", key},
+			[]string{"RPUSH", "list", key},
+			[]string{"GET", "missing"},
+		)
+		expected = append(expected, "ok", strconv.Itoa(i+1), strconv.Itoa(i), strconv.Itoa(i+1), internal.NilValue)
+	}
+
+	return queries, expected
+}
+
+func TestServerTCP_Pipeline(t *testing.T) {
+	address := startServerTCP(t, internal.NetworkConfig{IdleTimeout: time.Minute})
+	queries, expected := mixedPipeline(200)
+
+	t.Run("text", func(t *testing.T) {
+		c, cl, err := client.NewClientTCP(address, zerolog.Nop(), 5*time.Second, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cl()
+
+		// каждый тест работает в своем пространстве ключей
+		if _, err = c.Query(context.Background(), "SELECT 1"); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := make([]string, 0, len(queries))
+		for _, args := range queries {
+			lines = append(lines, strings.Join(args, " "))
+		}
+		results, err := c.Pipeline(context.Background(), lines)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make([]string, 0, len(results))
+		for _, r := range results {
+			if errors.Is(r.Err, internal.ErrNotFound) {
+				r.Value = internal.NilValue
+			} else if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			got = append(got, r.Value)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected replies %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("resp", func(t *testing.T) {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		var buf strings.Builder
+		for _, args := range append([][]string{{"SELECT", "2"}}, queries...) {
+			fmt.Fprintf(&buf, "*%d\r\n", len(args))
+			for _, arg := range args {
+				fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+			}
+		}
+		if _, err = conn.Write([]byte(buf.String())); err != nil {
+			t.Fatal(err)
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		reader := bufio.NewReader(conn)
+		// readReply читает ответ из одной строки или bulk строку
+		readReply := func() string {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			line = strings.TrimSuffix(line, "\r\n")
+			switch {
+			case line == "$-1":
+				return internal.NilValue
+			case line[0] == '$':
+				if line, err = reader.ReadString('\n'); err != nil {
+					t.Fatal(err)
+				}
+				return strings.TrimSuffix(line, "\r\n")
+			default:
+				return line[1:]
+			}
+		}
+
+		if reply := readReply(); reply != "ok" {
+			t.Fatalf("unexpected SELECT reply %q", reply)
+		}
+		got := make([]string, 0, len(queries))
+		for range queries {
+			got = append(got, readReply())
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected replies %v, got %v", expected, got)
+		}
+	})
+}
+
+func TestServerTCP_IdleTimeoutBlocking(t *testing.T) {
+	const idleTimeout = 200 * time.Millisecond
+	address := startServerTCP(t, internal.NetworkConfig{IdleTimeout: idleTimeout})
+
+	c, cl, err := client.NewClientTCP(address, zerolog.Nop(), 5*time.Second, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl()
+
+	// BLPOP ждет дольше idle timeout, соединение не должно закрыться
+	start := time.Now()
+	if _, err = c.Query(context.Background(), "BLPOP queue 0.6"); !errors.Is(err, internal.ErrTimeout) {
+		t.Fatalf("expected BLPOP timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 3*idleTimeout {
+		t.Fatalf("BLPOP returned after %s", elapsed)
+	}
+
+	pusher, clPusher, err := client.NewClientTCP(address, zerolog.Nop(), 5*time.Second, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clPusher()
+	go func() {
+		time.Sleep(3 * idleTimeout)
+		_, _ = pusher.Query(context.Background(), "RPUSH queue a")
+	}()
+
+	if val, err := c.Query(context.Background(), "BLPOP queue 0"); err != nil || val != "a" {
+		t.Fatalf("expected value from BLPOP, got %q %v", val, err)
+	}
+
+	// после ответа простой снова отсчитывается
+	time.Sleep(2 * idleTimeout)
+	if _, err = c.Query(context.Background(), "PING"); err == nil {
+		t.Error("expected idle connection to be closed")
+	}
+}
+
+func TestClientTCP_BlockingTimeout(t *testing.T) {
+	address := startServerTCP(t, internal.NetworkConfig{IdleTimeout: time.Minute})
+
+	// ответ на BLPOP ждется дольше таймаута чтения клиента
+	c, cl, err := client.NewClientTCP(address, zerolog.Nop(), 100*time.Millisecond, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl()
+
+	if _, err = c.Query(context.Background(), "BLPOP queue 0.4"); !errors.Is(err, internal.ErrTimeout) {
+		t.Fatalf("expected BLPOP timeout from server, got %v", err)
+	}
+
+	pusher, clPusher, err := client.NewClientTCP(address, zerolog.Nop(), 5*time.Second, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clPusher()
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_, _ = pusher.Query(context.Background(), "RPUSH queue a")
+	}()
+
+	if val, err := c.Query(context.Background(), "BLPOP queue 0"); err != nil || val != "a" {
+		t.Fatalf("expected value from BLPOP, got %q %v", val, err)
+	}
+	if _, err = c.Query(context.Background(), "PING"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerTCP_BLPopDisconnect(t *testing.T) {
+	address := startServerTCP(t, internal.NetworkConfig{IdleTimeout: time.Minute})
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Write([]byte("BLPOP queue 0\n")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	_ = conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	c, cl, err := client.NewClientTCP(address, zerolog.Nop(), 5*time.Second, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl()
+
+	// отключившийся клиент не должен забрать элемент
+	if _, err = c.Query(context.Background(), "RPUSH queue a"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if length, err := c.Query(context.Background(), "LLEN queue"); err != nil || length != "1" {
+		t.Fatalf("expected element to stay in list, got %q %v", length, err)
+	}
+}
+
+func TestServerTCP_RESPMissingKey(t *testing.T) {
+	address := startServerTCP(t, internal.NetworkConfig{IdleTimeout: time.Minute})
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	tests := []struct {
+		args   []string
+		prefix string
+	}{
+		{args: []string{"SELECT", "resp-missing"}, prefix: "+"},
+		{args: []string{"GET", "missing"}, prefix: "$-1"},
+		{args: []string{"HGET", "missing", "f"}, prefix: "$-1"},
+		{args: []string{"LPOP", "missing"}, prefix: "$-1"},
+		{args: []string{"BLPOP", "missing", "0.01"}, prefix: "$-1"},
+		{args: []string{"RENAME", "missing", "dst"}, prefix: "-"},
+		{args: []string{"COPY", "missing", "dst"}, prefix: "-"},
+		{args: []string{"HDEL", "missing", "f"}, prefix: ":0"},
+	}
+	for _, tt := range tests {
+		var buf strings.Builder
+		fmt.Fprintf(&buf, "*%d\r\n", len(tt.args))
+		for _, arg := range tt.args {
+			fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+		if _, err = conn.Write([]byte(buf.String())); err != nil {
+			t.Fatal(err)
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(line, tt.prefix) {
+			t.Errorf("%s: expected reply starting with %q, got %q", strings.Join(tt.args, " "), tt.prefix, line)
+		}
+	}
+}
+
+func TestServerTCP_TextFraming(t *testing.T) {
+	address := startServerTCP(t, internal.NetworkConfig{IdleTimeout: time.Minute})
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	// RESP принимает любые байты, в том числе пробелы и переводы строк
+	for _, args := range [][]string{
+		{"SELECT", "framing"},
+		{"SET", "k", "line1\nline2 \"quoted\""},
+		{"RPUSH", "l", "a b", "c"},
+	} {
+		var buf strings.Builder
+		fmt.Fprintf(&buf, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+		if _, err = conn.Write([]byte(buf.String())); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = reader.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, cl, err := client.NewClientTCP(address, zerolog.Nop(), 5*time.Second, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl()
+
+	results, err := c.Pipeline(context.Background(), []string{"SELECT framing", "GET k", "LRANGE l 0 -1", "PING"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(results))
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		got = append(got, r.Value)
+	}
+	expected := []string{"ok", `"line1\nline2 \"quoted\""`, `"a b" c`, "PONG"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected replies %v, got %v", expected, got)
+	}
+
+	value, err := strconv.Unquote(got[1])
+	if err != nil || value != "line1\nline2 \"quoted\"" {
+		t.Errorf("expected quoted value to round-trip, got %q %v", value, err)
+	}
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// TLSConfig настройки TLS сервера, TLS включается, если задан сертификат
+type TLSConfig struct {
+	CertFile string `yaml:"cert" mapstructure:"cert"`
+	KeyFile  string `yaml:"key" mapstructure:"key"`
+	// ClientCAFile корневой сертификат клиентов, если задан, сервер требует сертификат клиента
+	ClientCAFile string `yaml:"client_ca" mapstructure:"client_ca"`
+	// MinVersion минимальная версия TLS: 1.2 или 1.3
+	MinVersion string `yaml:"min_version" mapstructure:"min_version"`
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+var tlsVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewServerTLSConfig загружает сертификаты сервера и корневой сертификат клиентов
+func NewServerTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	minVersion, has := tlsVersions[cfg.MinVersion]
+	if !has {
+		return nil, errors.Errorf("unsupported tls version %s", cfg.MinVersion)
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load certificate")
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+	}
+
+	if cfg.ClientCAFile != "" {
+		pool, err := LoadCertPool(cfg.ClientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load client ca")
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// LoadCertPool читает сертификаты в формате PEM
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.Errorf("no certificates in %s", path)
+	}
+
+	return pool, nil
+}
+
+// certificateIdentity возвращает имя клиента из проверенного сертификата:
+// common name, а если его нет, subject целиком
+func certificateIdentity(state tls.ConnectionState) string {
+	if len(state.PeerCertificates) == 0 {
+		return ""
+	}
+
+	subject := state.PeerCertificates[0].Subject
+	if subject.CommonName != "" {
+		return subject.CommonName
+	}
+
+	return subject.String()
+}
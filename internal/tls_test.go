@@ -0,0 +1,190 @@
+package internal_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+	"key-value-storage/internal/client"
+)
+
+// writeCert выпускает сертификат, подписанный parent, и сохраняет его с ключом в dir
+func writeCert(t *testing.T, dir, name string, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err = os.WriteFile(path.Join(dir, name+".crt"), certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func freeAddress(t *testing.T) net.TCPAddr {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return *l.Addr().(*net.TCPAddr)
+}
+
+// syncBuffer буфер для логов сервера, в который пишут несколько горутин
+type syncBuffer struct {
+	mtx sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return b.buf.String()
+}
+
+func TestServerTCP_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	notAfter := time.Now().Add(time.Hour)
+
+	ca, caKey := writeCert(t, dir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	writeCert(t, dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	writeCert(t, dir, "client", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "reporter"},
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	logs := &syncBuffer{}
+	logger := zerolog.New(logs)
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := freeAddress(t)
+	server := internal.NewServerTCP(internal.NetworkConfig{
+		MaxConnections: 10,
+		IdleTimeout:    time.Minute,
+		Address:        address,
+		TLS: internal.TLSConfig{
+			CertFile:     path.Join(dir, "server.crt"),
+			KeyFile:      path.Join(dir, "server.key"),
+			ClientCAFile: path.Join(dir, "ca.crt"),
+			MinVersion:   "1.3",
+		},
+	}, internal.NewDB(internal.NewParser(logger), storage, logger), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = server.Run(ctx) }()
+	time.Sleep(100 * time.Millisecond)
+
+	t.Run("client certificate", func(t *testing.T) {
+		tlsConfig, err := client.NewTLSConfig(client.TLSOptions{
+			CAFile:   path.Join(dir, "ca.crt"),
+			CertFile: path.Join(dir, "client.crt"),
+			KeyFile:  path.Join(dir, "client.key"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, cl, err := client.NewClientTCP(address.String(), zerolog.Nop(), time.Second, 0, tlsConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cl()
+
+		resp, err := c.Query(context.Background(), "PING")
+		if err != nil || resp != "PONG" {
+			t.Fatalf("expected PONG, got %q %v", resp, err)
+		}
+		if !strings.Contains(logs.String(), "identified by certificate as reporter") {
+			t.Fatalf("client identity is not logged: %s", logs.String())
+		}
+	})
+
+	t.Run("no client certificate", func(t *testing.T) {
+		tlsConfig, err := client.NewTLSConfig(client.TLSOptions{CAFile: path.Join(dir, "ca.crt")})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, cl, err := client.NewClientTCP(address.String(), zerolog.Nop(), time.Second, 0, tlsConfig)
+		if err != nil {
+			// в TLS 1.3 сервер может отклонить сертификат уже после рукопожатия клиента
+			return
+		}
+		defer cl()
+
+		if _, err = c.Query(context.Background(), "PING"); err == nil {
+			t.Fatal("expected connection without client certificate to fail")
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// UnixScheme префикс адреса Unix-сокета у клиента
+const UnixScheme = "unix://"
+
+// UnixSocketConfig Unix-сокет для клиентов на том же хосте, сокет включается, если задан путь
+type UnixSocketConfig struct {
+	Path string `yaml:"path" mapstructure:"path"`
+	// Permissions права на файл сокета, например 0660. 0 оставляет права по umask
+	Permissions uint32 `yaml:"permissions" mapstructure:"permissions"`
+}
+
+func (c UnixSocketConfig) Enabled() bool {
+	return c.Path != ""
+}
+
+// ListenUnix слушает Unix-сокет. Файл, оставшийся после аварийной остановки,
+// удаляется, если к нему никто не подключен. Сокет создается в каталоге с правами 0700
+// и переносится на место уже с нужными правами, поэтому подключиться раньше chmod нельзя
+func ListenUnix(cfg UnixSocketConfig) (net.Listener, error) {
+	if err := removeStaleSocket(cfg.Path); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(cfg.Path), ".socket-")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create socket directory")
+	}
+	defer os.RemoveAll(dir)
+
+	tmpPath := filepath.Join(dir, filepath.Base(cfg.Path))
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmpPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// файл удаляет unixListener, так как после переноса у него другой путь
+	listener.SetUnlinkOnClose(false)
+
+	if cfg.Permissions != 0 {
+		if err = os.Chmod(tmpPath, fs.FileMode(cfg.Permissions)); err != nil {
+			_ = listener.Close()
+			return nil, errors.Wrap(err, "failed to set socket permissions")
+		}
+	}
+
+	if err = os.Rename(tmpPath, cfg.Path); err != nil {
+		_ = listener.Close()
+		return nil, errors.Wrap(err, "failed to move socket")
+	}
+
+	return &unixListener{UnixListener: listener, path: cfg.Path}, nil
+}
+
+// unixListener удаляет файл сокета при закрытии
+type unixListener struct {
+	*net.UnixListener
+	path      string
+	closeOnce sync.Once
+}
+
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+func (l *unixListener) Close() error {
+	// файл удаляется до закрытия, чтобы он исчез к моменту, когда Accept вернет ошибку
+	l.closeOnce.Do(func() {
+		_ = os.Remove(l.path)
+	})
+
+	return l.UnixListener.Close()
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode().Type() != fs.ModeSocket {
+		return errors.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return errors.Errorf("socket %s is in use", path)
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,31 @@
+//go:build linux
+
+package internal
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// unixPeer возвращает uid процесса на другой стороне Unix-сокета, пустую строку если его не узнать
+func unixPeer(conn net.Conn) string {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return ""
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return ""
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	if err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil || credErr != nil {
+		return ""
+	}
+
+	return "uid=" + strconv.FormatUint(uint64(cred.Uid), 10)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package internal
+
+import "net"
+
+// unixPeer без SO_PEERCRED клиентов Unix-сокета не различить, попытки считаются по имени пользователя
+func unixPeer(net.Conn) string {
+	return ""
+}
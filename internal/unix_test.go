@@ -0,0 +1,146 @@
+package internal_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+	"key-value-storage/internal/client"
+)
+
+func TestServerTCP_UnixSocket(t *testing.T) {
+	socket := path.Join(t.TempDir(), "kv.sock")
+
+	// сокет, оставшийся от аварийно остановленного сервера
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	logger := zerolog.Nop()
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := internal.NewServerTCP(internal.NetworkConfig{
+		MaxConnections: 10,
+		IdleTimeout:    time.Minute,
+		UnixSocket:     internal.UnixSocketConfig{Path: socket, Permissions: 0o600},
+		DisableTCP:     true,
+		DrainTimeout:   time.Second,
+	}, internal.NewDB(internal.NewParser(logger), storage, logger), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- server.Run(ctx) }()
+	time.Sleep(100 * time.Millisecond)
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected socket permissions 0600, got %o", info.Mode().Perm())
+	}
+
+	c, cl, err := client.NewClientTCP(internal.UnixScheme+socket, logger, time.Second, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Query(context.Background(), "PING")
+	if err != nil || resp != "PONG" {
+		t.Fatalf("expected PONG, got %q %v", resp, err)
+	}
+	cl()
+
+	cancel()
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("expected socket file to be removed on stop, got %v", err)
+	}
+}
+
+func TestServerTCP_UnixSocketAuthLockout(t *testing.T) {
+	dir := t.TempDir()
+	socket := path.Join(dir, "kv.sock")
+
+	hash, err := internal.HashPassword("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := internal.NewAuthenticator(internal.AuthConfig{
+		Users:       []internal.UserConfig{{Name: "reporter", Password: hash}},
+		MaxFailures: 2,
+		Lockout:     time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.Nop()
+	storage, err := internal.NewStorageWithEngine(internal.EngineConfig{Type: internal.InMemoryEngineType}, nil, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := internal.NewServerTCP(internal.NetworkConfig{
+		MaxConnections: 10,
+		IdleTimeout:    time.Minute,
+		UnixSocket:     internal.UnixSocketConfig{Path: socket, Permissions: 0o600},
+		DisableTCP:     true,
+		DrainTimeout:   time.Second,
+	}, internal.NewDB(internal.NewParser(logger), storage, logger, internal.WithAuth(auth)), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- server.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// рядом с сокетом не остается временного каталога
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "kv.sock" {
+		t.Errorf("expected only socket in directory, got %v", entries)
+	}
+
+	attacker, clAttacker, err := client.NewClientTCP(internal.UnixScheme+socket, logger, time.Second, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clAttacker()
+	for range 3 {
+		_, _ = attacker.Query(context.Background(), "AUTH reporter wrong")
+	}
+	if _, err = attacker.Query(context.Background(), "AUTH reporter s3cret"); !errors.Is(err, internal.ErrAuthLocked) {
+		t.Fatalf("expected ErrAuthLocked, got %v", err)
+	}
+
+	// переподключение не снимает блокировку
+	c, cl, err := client.NewClientTCP(internal.UnixScheme+socket, logger, time.Second, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl()
+	if _, err = c.Query(context.Background(), "AUTH reporter s3cret"); !errors.Is(err, internal.ErrAuthLocked) {
+		t.Fatalf("expected ErrAuthLocked after reconnect, got %v", err)
+	}
+}
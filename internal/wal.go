@@ -30,8 +30,7 @@ type Writer struct {
 	segment       *os.File
 	segmentWriter *bufio.Writer
 
-	encoder *gob.Encoder
-	buffer  *bytes.Buffer
+	buffer *bytes.Buffer
 
 	dir string
 }
@@ -43,7 +42,6 @@ func NewWriter(dirPath string, maxSize int64) (*Writer, error) {
 		size:          0,
 		segment:       nil,
 		segmentWriter: nil,
-		encoder:       gob.NewEncoder(buffer),
 		buffer:        buffer,
 		dir:           dirPath,
 	}
@@ -57,8 +55,11 @@ func NewWriter(dirPath string, maxSize int64) (*Writer, error) {
 }
 
 func (w *Writer) Write(commands []Command) error {
-	for cmd := range commands {
-		err := w.encoder.Encode(cmd)
+	for _, cmd := range commands {
+		// каждая запись кодируется отдельным энкодером вместе с описанием типа,
+		// чтобы сегменты, дописанные после перезапуска, читались независимо
+		w.buffer.Reset()
+		err := gob.NewEncoder(w.buffer).Encode(cmd)
 		if err != nil {
 			return errors.Wrap(err, "failed to encode command")
 		}
@@ -88,6 +89,23 @@ func (w *Writer) Write(commands []Command) error {
 	return nil
 }
 
+// Close записывает буфер, синхронизирует текущий сегмент с диском и закрывает его
+func (w *Writer) Close() error {
+	if err := w.segmentWriter.Flush(); err != nil {
+		return errors.Wrap(err, "failed to flush segment")
+	}
+
+	if err := w.segment.Sync(); err != nil {
+		return errors.Wrapf(err, "failed to sync segment %s", w.segment.Name())
+	}
+
+	if err := w.segment.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close segment %s", w.segment.Name())
+	}
+
+	return nil
+}
+
 func (w *Writer) openSegment(dirPath string) error {
 	if w.segment != nil {
 		return errors.New("segment already open")
@@ -102,6 +120,7 @@ func (w *Writer) openSegment(dirPath string) error {
 	if err != nil {
 		return errors.Wrapf(err, "failed to open dir %s", dirPath)
 	}
+	defer dir.Close()
 
 	currentFileName, size, err := w.findFileName(dir)
 	if err != nil {
@@ -121,7 +140,7 @@ func (w *Writer) openSegment(dirPath string) error {
 }
 
 func (w *Writer) nextSegment() error {
-	segmentNum, err := strconv.Atoi(w.segment.Name())
+	segmentNum, err := strconv.Atoi(path.Base(w.segment.Name()))
 	if err != nil {
 		return errors.Wrapf(err, "failed to read segment num")
 	}
@@ -161,17 +180,14 @@ func (w *Writer) findFileName(dir *os.File) (string, int64, error) {
 	}
 
 	files = slices.DeleteFunc(files, func(e os.DirEntry) bool {
-		if e.IsDir() {
-			return true
-		}
-
-		isInvalidName := strings.ContainsFunc(e.Name(), func(r rune) bool {
-			return r < '0' || r > '9'
-		})
-		return isInvalidName
+		return e.IsDir() || !isSegmentName(e.Name())
 	})
+	if len(files) == 0 {
+		return "1", 0, nil
+	}
+
 	slices.SortFunc(files, func(a, b os.DirEntry) int {
-		return strings.Compare(a.Name(), b.Name())
+		return compareSegmentNames(a.Name(), b.Name())
 	})
 
 	maxFile := files[len(files)-1]
@@ -195,6 +211,72 @@ func (w *Writer) findFileName(dir *os.File) (string, int64, error) {
 	return currentFileName, 0, nil
 }
 
+// compareSegmentNames сравнивает имена сегментов как числа
+func compareSegmentNames(a, b string) int {
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+
+	return strings.Compare(a, b)
+}
+
+// ReadSegments читает записи всех сегментов в порядке их номеров и передает их в apply
+func ReadSegments(dirPath string, apply func(Command) error) error {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to read dir %s", dirPath)
+	}
+
+	entries = slices.DeleteFunc(entries, func(e os.DirEntry) bool {
+		return e.IsDir() || !isSegmentName(e.Name())
+	})
+	slices.SortFunc(entries, func(a, b os.DirEntry) int {
+		return compareSegmentNames(a.Name(), b.Name())
+	})
+
+	for _, entry := range entries {
+		if err = readSegment(path.Join(dirPath, entry.Name()), apply); err != nil {
+			return errors.Wrapf(err, "failed to read segment %s", entry.Name())
+		}
+	}
+
+	return nil
+}
+
+func readSegment(segmentPath string, apply func(Command) error) error {
+	segment, err := os.Open(segmentPath)
+	if err != nil {
+		return err
+	}
+	defer segment.Close()
+
+	reader := bufio.NewReader(segment)
+	for {
+		var cmd Command
+		// декодер читает из io.ByteReader ровно одну запись, не забегая вперед
+		err = gob.NewDecoder(reader).Decode(&cmd)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to decode command")
+		}
+
+		if err = apply(cmd); err != nil {
+			return errors.Wrapf(err, "failed to apply command %s", cmd.Type)
+		}
+	}
+}
+
+func isSegmentName(name string) bool {
+	return name != "" && !strings.ContainsFunc(name, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+}
+
 type Wal struct {
 	cfg WalConfig
 	t   *time.Ticker
@@ -202,6 +284,8 @@ type Wal struct {
 	batchMtx sync.Mutex
 	batch    *Batch
 	writer   *Writer
+	// flushMtx не дает записывать батчи одновременно, Close ждет через него начатую запись
+	flushMtx sync.Mutex
 
 	logger zerolog.Logger
 
@@ -240,7 +324,31 @@ func (w *Wal) Run(ctx context.Context) {
 	}
 }
 
+// Close записывает накопленный батч и закрывает сегмент с синхронизацией на диск.
+// Вызывается после остановки Run, когда новых команд уже нет.
+// flush мог бы вернуть результат уже начатой записи, не забравшей последние команды,
+// поэтому Close дожидается ее и записывает остаток сам
+func (w *Wal) Close() error {
+	w.t.Stop()
+
+	w.flushMtx.Lock()
+	defer w.flushMtx.Unlock()
+
+	if err := w.writeBatch(); err != nil {
+		return errors.Wrap(err, "failed to flush last batch")
+	}
+
+	return w.writer.Close()
+}
+
+// Push добавляет команду в батч и ждет его записи на диск
 func (w *Wal) Push(ctx context.Context, cmd Command) error {
+	return w.Wait(ctx, w.Append(cmd))
+}
+
+// Append добавляет команду в текущий батч не дожидаясь записи,
+// порядок вызовов Append совпадает с порядком записей на диске
+func (w *Wal) Append(cmd Command) *Batch {
 	if !w.cfg.Enabled {
 		return nil
 	}
@@ -259,6 +367,15 @@ func (w *Wal) Push(ctx context.Context, cmd Command) error {
 		}()
 	}
 
+	return batch
+}
+
+// Wait ждет записи батча на диск
+func (w *Wal) Wait(ctx context.Context, batch *Batch) error {
+	if batch == nil {
+		return nil
+	}
+
 	select {
 	case <-batch.flushDoneCh:
 		return batch.flushErr
@@ -271,25 +388,33 @@ func (w *Wal) flush() error {
 	_, err := w.sf.Do(newBatchSfGroup, func() (interface{}, error) {
 		w.logger.Debug().Msgf("batch is full, flushing...")
 
-		w.batchMtx.Lock()
-		batch := w.batch
-		w.batch = NewBatch(w.cfg.BatchSize)
-		w.batchMtx.Unlock()
-
-		defer close(batch.flushDoneCh)
+		w.flushMtx.Lock()
+		defer w.flushMtx.Unlock()
 
-		err := w.writer.Write(batch.data)
-		if err != nil {
-			batch.flushErr = err
-			return nil, err
-		}
-
-		return nil, nil
+		return nil, w.writeBatch()
 	})
 
 	return err
 }
 
+// writeBatch забирает текущий батч и записывает его, вызывается под flushMtx
+func (w *Wal) writeBatch() error {
+	w.batchMtx.Lock()
+	batch := w.batch
+	w.batch = NewBatch(w.cfg.BatchSize)
+	w.batchMtx.Unlock()
+
+	defer close(batch.flushDoneCh)
+
+	err := w.writer.Write(batch.data)
+	if err != nil {
+		batch.flushErr = err
+		return err
+	}
+
+	return nil
+}
+
 type Batch struct {
 	flushErr    error
 	flushDoneCh chan struct{}
@@ -1,8 +1,180 @@
 package internal_test
 
-import "testing"
+import (
+	"context"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"key-value-storage/internal"
+)
 
 func TestWriter_Write(t *testing.T) {
-	const dirPath = "./test_dir"
-	t.Run("test ")
+	t.Run("writes commands to first segment", func(t *testing.T) {
+		dirPath := t.TempDir()
+		w, err := internal.NewWriter(dirPath, 1024*1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = w.Write([]internal.Command{
+			{Type: internal.Set, Args: []string{"a", "1"}},
+			{Type: internal.MSet, Args: []string{"b", "2", "c", "3"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := os.ReadDir(dirPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Name() != "1" {
+			t.Fatalf("expected single segment '1', got %v", entries)
+		}
+
+		info, err := entries[0].Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == 0 {
+			t.Fatal("segment is empty")
+		}
+	})
+
+	t.Run("rotates segment on max size", func(t *testing.T) {
+		dirPath := t.TempDir()
+		w, err := internal.NewWriter(dirPath, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for range 10 {
+			err = w.Write([]internal.Command{{Type: internal.Set, Args: []string{"key", "value"}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		entries, err := os.ReadDir(dirPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) < 2 {
+			t.Fatalf("expected several segments, got %d", len(entries))
+		}
+	})
+}
+
+func TestReadSegments(t *testing.T) {
+	dirPath := t.TempDir()
+	written := []internal.Command{
+		{Type: internal.Set, Args: []string{"a", "1"}},
+		{Type: internal.MSet, Args: []string{"b", "2", "c", "3"}},
+		{Type: internal.Del, Args: []string{"a"}},
+	}
+
+	// второй writer имитирует перезапуск с дозаписью в тот же сегмент
+	for _, cmd := range written {
+		w, err := internal.NewWriter(dirPath, 1024*1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Write([]internal.Command{cmd}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var read []internal.Command
+	err := internal.ReadSegments(dirPath, func(cmd internal.Command) error {
+		read = append(read, cmd)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(read, written) {
+		t.Fatalf("expected %v, got %v", written, read)
+	}
+}
+
+func TestWal_Close(t *testing.T) {
+	dirPath := t.TempDir()
+	w, err := internal.NewWal(internal.WalConfig{
+		Enabled:      true,
+		BatchSize:    100,
+		BatchTimeout: time.Hour,
+		SegmentSize:  1024 * 1024,
+		DataDir:      dirPath,
+	}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// батч не заполнен и таймер не сработал, команду записывает только Close
+	cmd := internal.Command{Type: internal.Set, Args: []string{"a", "1"}}
+	batch := w.Append(cmd)
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Wait(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+
+	var restored []internal.Command
+	err = internal.ReadSegments(dirPath, func(c internal.Command) error {
+		restored = append(restored, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored, []internal.Command{cmd}) {
+		t.Fatalf("expected %v, got %v", cmd, restored)
+	}
+}
+
+func TestWal_CloseDuringFlush(t *testing.T) {
+	for range 20 {
+		dirPath := t.TempDir()
+		w, err := internal.NewWal(internal.WalConfig{
+			Enabled:      true,
+			BatchSize:    1,
+			BatchTimeout: time.Hour,
+			SegmentSize:  1024 * 1024,
+			DataDir:      dirPath,
+		}, zerolog.Nop())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// переполненные батчи записываются в фоне, Close не должен потерять команды,
+		// добавленные после того, как фоновая запись забрала свой батч
+		var written []internal.Command
+		for i := range 50 {
+			cmd := internal.Command{Type: internal.Set, Args: []string{"k", strconv.Itoa(i)}}
+			written = append(written, cmd)
+			w.Append(cmd)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var restored []internal.Command
+		err = internal.ReadSegments(dirPath, func(c internal.Command) error {
+			restored = append(restored, c)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(restored, written) {
+			t.Fatalf("expected %d commands, got %d", len(written), len(restored))
+		}
+	}
 }